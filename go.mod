@@ -0,0 +1,9 @@
+module go.ltgt.net
+
+go 1.21
+
+require (
+	github.com/andybalholm/brotli v1.1.1
+	github.com/klauspost/compress v1.17.11
+	golang.org/x/tools v0.9.1
+)
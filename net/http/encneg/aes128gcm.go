@@ -0,0 +1,321 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	cryptoaes "crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+)
+
+// DefaultRecordSize is the record size used by NewAES128GCMWriter when the
+// given record size is zero.
+const DefaultRecordSize = 4096
+
+const (
+	aes128gcmSaltSize  = 16
+	aes128gcmHeaderMin = aes128gcmSaltSize + 4 + 1
+	aes128gcmTagSize   = 16
+	aes128gcmMinRS     = aes128gcmTagSize + 2
+
+	// maxAES128GCMRecordSize is the maximum record size accepted when
+	// decoding, to bound memory usage.
+	maxAES128GCMRecordSize = 1 << 20
+)
+
+// randReader is the source of random salts; tests can replace it.
+var randReader = rand.Reader
+
+var (
+	errAES128GCMRecordSize = errors.New("encneg: invalid aes128gcm record size")
+	errAES128GCMKeyID      = errors.New("encneg: aes128gcm key ID too long")
+	errAES128GCMTruncated  = errors.New("encneg: truncated aes128gcm content")
+	errAES128GCMPadding    = errors.New("encneg: invalid aes128gcm record padding")
+	errAES128GCMTrailing   = errors.New("encneg: data after last aes128gcm record")
+)
+
+// GetAES128GCMWriter sets a "Content-Encoding: aes128gcm" response header and
+// returns an io.WriteCloser encrypting the response with the given key,
+// as defined in RFC 8188. It is the caller's responsibility to Close it.
+//
+// See NewAES128GCMWriter for details about the arguments.
+func GetAES128GCMWriter(w http.ResponseWriter, key, keyID []byte, recordSize int) (io.WriteCloser, error) {
+	ew, err := NewAES128GCMWriter(w, key, keyID, recordSize)
+	if err != nil {
+		return nil, err
+	}
+	w.Header().Set("Content-Encoding", "aes128gcm")
+	return ew, nil
+}
+
+// NewAES128GCMWriter returns an io.WriteCloser that encrypts to w using the
+// aes128gcm content coding defined in RFC 8188, deriving the content
+// encryption key from the given input keying material and a random salt.
+//
+// The keyID is sent as-is in the content coding header, and must be at most
+// 255 bytes long. The recordSize must be at least 18 bytes; if zero,
+// DefaultRecordSize is used.
+//
+// Data is buffered and sent in records of recordSize bytes; it is the
+// caller's responsibility to Close the returned writer to send the last
+// record.
+func NewAES128GCMWriter(w io.Writer, key, keyID []byte, recordSize int) (io.WriteCloser, error) {
+	if recordSize == 0 {
+		recordSize = DefaultRecordSize
+	}
+	if recordSize < aes128gcmMinRS || uint64(recordSize) > 0xffffffff {
+		return nil, errAES128GCMRecordSize
+	}
+	if len(keyID) > 255 {
+		return nil, errAES128GCMKeyID
+	}
+	salt := make([]byte, aes128gcmSaltSize)
+	if _, err := io.ReadFull(randReader, salt); err != nil {
+		return nil, err
+	}
+	aead, nonce, err := aes128gcmKeys(key, salt)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, aes128gcmHeaderMin, aes128gcmHeaderMin+len(keyID))
+	copy(header, salt)
+	binary.BigEndian.PutUint32(header[aes128gcmSaltSize:], uint32(recordSize))
+	header[aes128gcmHeaderMin-1] = byte(len(keyID))
+	header = append(header, keyID...)
+	return &aes128gcmWriter{
+		w:      w,
+		aead:   aead,
+		nonce:  nonce,
+		header: header,
+		buf:    make([]byte, 0, recordSize),
+		max:    recordSize - aes128gcmTagSize - 1,
+	}, nil
+}
+
+type aes128gcmWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	nonce  []byte
+	seq    uint64
+	header []byte // pending header, nil once written
+	buf    []byte // pending plaintext
+	max    int    // max plaintext size of a record
+	closed bool
+	err    error
+}
+
+func (e *aes128gcmWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("encneg: write to closed aes128gcm writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		if e.err != nil {
+			return n, e.err
+		}
+		// Only send a full record once we know it's not the last one.
+		if len(e.buf) == e.max {
+			e.writeRecord(false)
+			continue
+		}
+		c := copy(e.buf[len(e.buf):e.max], p)
+		e.buf = e.buf[:len(e.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, e.err
+}
+
+func (e *aes128gcmWriter) Close() error {
+	if e.closed {
+		return e.err
+	}
+	e.closed = true
+	if e.err == nil {
+		e.writeRecord(true)
+	}
+	return e.err
+}
+
+func (e *aes128gcmWriter) writeRecord(last bool) {
+	if e.header != nil {
+		if _, e.err = e.w.Write(e.header); e.err != nil {
+			return
+		}
+		e.header = nil
+	}
+	delimiter := byte(1)
+	if last {
+		delimiter = 2
+	}
+	record := append(e.buf, delimiter)
+	record = e.aead.Seal(record[:0], aes128gcmNonce(e.nonce, e.seq), record, nil)
+	e.seq++
+	_, e.err = e.w.Write(record)
+	e.buf = e.buf[:0]
+}
+
+// NewAES128GCMReader returns an io.Reader that decrypts r, encoded with the
+// aes128gcm content coding defined in RFC 8188.
+//
+// The keys function is called with the key ID from the content coding header
+// and returns the corresponding input keying material.
+//
+// To bound memory usage, record sizes larger than 1MiB are rejected.
+func NewAES128GCMReader(r io.Reader, keys func(keyID []byte) ([]byte, error)) io.Reader {
+	return &aes128gcmReader{r: r, keys: keys}
+}
+
+type aes128gcmReader struct {
+	r     io.Reader
+	keys  func(keyID []byte) ([]byte, error)
+	aead  cipher.AEAD
+	nonce []byte
+	seq   uint64
+	rs    int
+	rec   []byte // ciphertext buffer
+	plain []byte // pending plaintext
+	last  bool
+	err   error
+}
+
+func (d *aes128gcmReader) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		if d.last {
+			d.err = io.EOF
+			if n, _ := d.r.Read(d.rec[:1]); n > 0 {
+				d.err = errAES128GCMTrailing
+			}
+			continue
+		}
+		if d.aead == nil {
+			d.err = d.readHeader()
+			continue
+		}
+		d.err = d.readRecord()
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *aes128gcmReader) readHeader() error {
+	header := make([]byte, aes128gcmHeaderMin)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return truncated(err)
+	}
+	keyID := make([]byte, header[aes128gcmHeaderMin-1])
+	if _, err := io.ReadFull(d.r, keyID); err != nil {
+		return truncated(err)
+	}
+	rs := binary.BigEndian.Uint32(header[aes128gcmSaltSize:])
+	if rs < aes128gcmMinRS || rs > maxAES128GCMRecordSize {
+		return errAES128GCMRecordSize
+	}
+	key, err := d.keys(keyID)
+	if err != nil {
+		return err
+	}
+	d.aead, d.nonce, err = aes128gcmKeys(key, header[:aes128gcmSaltSize])
+	if err != nil {
+		return err
+	}
+	d.rs = int(rs)
+	d.rec = make([]byte, d.rs)
+	return nil
+}
+
+func (d *aes128gcmReader) readRecord() error {
+	n, err := io.ReadFull(d.r, d.rec)
+	if err == io.EOF {
+		// The last record must have a delimiter of 2
+		return errAES128GCMTruncated
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	plain, err := d.aead.Open(d.rec[:0], aes128gcmNonce(d.nonce, d.seq), d.rec[:n], nil)
+	if err != nil {
+		return err
+	}
+	d.seq++
+	// Remove padding, then the delimiter
+	i := len(plain) - 1
+	for i >= 0 && plain[i] == 0 {
+		i--
+	}
+	switch {
+	case i < 0:
+		return errAES128GCMPadding
+	case plain[i] == 2:
+		d.last = true
+	case plain[i] != 1 || n < d.rs:
+		// Only the last record can be shorter than the record size
+		return errAES128GCMPadding
+	}
+	d.plain = plain[:i]
+	return nil
+}
+
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errAES128GCMTruncated
+	}
+	return err
+}
+
+// aes128gcmKeys derives the content encryption key and nonce from the input
+// keying material and the salt, as defined in RFC 8188, Section 2.2 and 2.3.
+func aes128gcmKeys(ikm, salt []byte) (cipher.AEAD, []byte, error) {
+	prk := hkdfSHA256(salt, ikm)
+	block, err := cryptoaes.NewCipher(prk.expand([]byte("Content-Encoding: aes128gcm\x00"), 16))
+	if err != nil {
+		return nil, nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, nil, err
+	}
+	return aead, prk.expand([]byte("Content-Encoding: nonce\x00"), 12), nil
+}
+
+// aes128gcmNonce computes the nonce for the record with the given sequence
+// number, as defined in RFC 8188, Section 2.3.
+func aes128gcmNonce(base []byte, seq uint64) []byte {
+	nonce := make([]byte, len(base))
+	copy(nonce, base)
+	var s [8]byte
+	binary.BigEndian.PutUint64(s[:], seq)
+	for i := range s {
+		nonce[len(nonce)-8+i] ^= s[i]
+	}
+	return nonce
+}
+
+// An hkdfPRK is a pseudorandom key as produced by HKDF-Extract (RFC 5869.)
+type hkdfPRK []byte
+
+func hkdfSHA256(salt, ikm []byte) hkdfPRK {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write(ikm)
+	return mac.Sum(nil)
+}
+
+// expand implements HKDF-Expand (RFC 5869), limited to a single block of
+// output, which is enough for aes128gcm.
+func (prk hkdfPRK) expand(info []byte, length int) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write(info)
+	mac.Write([]byte{1})
+	return mac.Sum(nil)[:length]
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Test vectors from RFC 8188, Section 3.
+var aes128gcmTests = []struct {
+	name      string
+	key       string
+	keyID     string
+	rs        int
+	plaintext string
+	encoded   string
+}{
+	{
+		name:      "Section 3.1",
+		key:       "yqdlZ-tYemfogSmv7Ws5PQ",
+		rs:        4096,
+		plaintext: "I am the walrus",
+		encoded:   "I1BsxtFttlv3u_Oo94xnmwAAEAAA-NAVub2qFgBEuQKRapoZu-IxkIva3MEB1PD-ly8Thjg",
+	},
+	{
+		name:      "Section 3.2",
+		key:       "BO3ZVPxUlnLORbVGMpbT1Q",
+		keyID:     "a1",
+		rs:        25,
+		plaintext: "I am the walrus",
+		encoded:   "uNCkWiNYzKTnBN9ji3-qWAAAABkCYTHOG8chz_gnvgOqdGYovxyjuqRyJFjEDyoF1Fvkj6hQPdPHI51OEUKEpgz3SsLWIqS_uA",
+	},
+}
+
+func decodeBase64URL(t *testing.T, s string) []byte {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func keysFor(t *testing.T, keyID, key string) func([]byte) ([]byte, error) {
+	return func(id []byte) ([]byte, error) {
+		if string(id) != keyID {
+			return nil, errors.New("unknown key " + string(id))
+		}
+		return decodeBase64URL(t, key), nil
+	}
+}
+
+func TestAES128GCMReader(t *testing.T) {
+	for _, tt := range aes128gcmTests {
+		r := NewAES128GCMReader(bytes.NewReader(decodeBase64URL(t, tt.encoded)), keysFor(t, tt.keyID, tt.key))
+		if b, err := io.ReadAll(r); err != nil {
+			t.Errorf("test %s: %v", tt.name, err)
+		} else if g, e := string(b), tt.plaintext; g != e {
+			t.Errorf("test %s: plaintext = %q, want %q", tt.name, g, e)
+		}
+
+		// Truncated content
+		encoded := decodeBase64URL(t, tt.encoded)
+		r = NewAES128GCMReader(bytes.NewReader(encoded[:len(encoded)-1]), keysFor(t, tt.keyID, tt.key))
+		if _, err := io.ReadAll(r); err == nil {
+			t.Errorf("test %s: truncated content: expected error", tt.name)
+		}
+	}
+}
+
+func TestAES128GCMWriter(t *testing.T) {
+	defer func(r io.Reader) { randReader = r }(randReader)
+
+	// The Section 3.2 test vector uses padding, which NewAES128GCMWriter
+	// never adds, so only test against Section 3.1.
+	tt := aes128gcmTests[0]
+	encoded := decodeBase64URL(t, tt.encoded)
+	randReader = bytes.NewReader(encoded[:16])
+	var buf bytes.Buffer
+	w, err := NewAES128GCMWriter(&buf, decodeBase64URL(t, tt.key), []byte(tt.keyID), tt.rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte(tt.plaintext))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := base64.RawURLEncoding.EncodeToString(buf.Bytes()), tt.encoded; g != e {
+		t.Errorf("test %s: encoded = %q, want %q", tt.name, g, e)
+	}
+}
+
+func TestAES128GCMRoundTrip(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	keys := func([]byte) ([]byte, error) { return key, nil }
+	for _, size := range []int{0, 1, 6, 7, 8, 20, 100} {
+		plaintext := strings.Repeat("x", size)
+		var buf bytes.Buffer
+		// Records hold 7 bytes of plaintext
+		w, err := NewAES128GCMWriter(&buf, key, []byte("k"), 24)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(plaintext))
+		w.Close()
+
+		if b, err := io.ReadAll(NewAES128GCMReader(&buf, keys)); err != nil {
+			t.Errorf("test %d: %v", size, err)
+		} else if g, e := string(b), plaintext; g != e {
+			t.Errorf("test %d: plaintext = %q, want %q", size, g, e)
+		}
+	}
+}
+
+func TestGetAES128GCMWriter(t *testing.T) {
+	key := []byte("0123456789abcdef")
+	rec := httptest.NewRecorder()
+	w, err := GetAES128GCMWriter(rec, key, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("Hello World!"))
+	w.Close()
+
+	if g, e := rec.Header().Get("Content-Encoding"), "aes128gcm"; g != e {
+		t.Errorf("content-encoding = %q, want %q", g, e)
+	}
+
+	// Decode it as a request body
+	var gotBody string
+	var gotErr error
+	handler := DecodeRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		gotBody, gotErr = string(b), err
+	}), &DecodeOptions{Keys: func([]byte) ([]byte, error) { return key, nil }})
+	req := httptest.NewRequest("POST", "/", rec.Body)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if gotErr != nil {
+		t.Error(gotErr)
+	} else if g, e := gotBody, "Hello World!"; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
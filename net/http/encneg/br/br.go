@@ -0,0 +1,32 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package br registers the br content coding (Brotli, RFC 7932) with
+// encneg, so that encneg.Transport and encneg.DecodeRequest support it.
+//
+// It's meant to be imported for its side effect:
+//
+//	import _ "go.ltgt.net/net/http/encneg/br"
+//
+// It's a separate package so that only programs that need Brotli depend on
+// a Brotli implementation.
+package br
+
+import (
+	"io"
+
+	"github.com/andybalholm/brotli"
+	"go.ltgt.net/net/http/encneg"
+)
+
+func init() {
+	encneg.RegisterCoding("br", encneg.Coding{
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return io.NopCloser(brotli.NewReader(r)), nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return brotli.NewWriter(w), nil
+		},
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"net/http"
+)
+
+// contextKey is a value for use with context.WithValue. It's used as
+// a pointer so it fits in an interface{} without allocation.
+type contextKey struct {
+	name string
+}
+
+func (k *contextKey) String() string { return "encneg context value " + k.name }
+
+var (
+	disableCompressionKey = &contextKey{"disable-compression"}
+	compressionPaddingKey = &contextKey{"compression-padding"}
+)
+
+// The padding added by PadCompression is a single subfield of the gzip
+// header's extra field (RFC 1952, Section 2.3.1.1), whose size is bounded to
+// 65535 bytes, including the 4-byte subfield header.
+const (
+	paddingSI1, paddingSI2 = 'P', 'd'
+	maxPadding             = 0xffff - 4
+)
+
+// DisableCompression returns a shallow copy of r whose context tells GetWriter
+// not to compress the response.
+//
+// Handlers should use it for responses that reflect user input alongside
+// secrets (such as CSRF tokens), to protect them from BREACH attacks:
+//
+//	if hasSecrets {
+//		r = encneg.DisableCompression(r)
+//	}
+//	gw := encneg.GetWriter(w, r)
+func DisableCompression(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), disableCompressionKey, true))
+}
+
+func compressionDisabled(r *http.Request) bool {
+	disabled, _ := r.Context().Value(disableCompressionKey).(bool)
+	return disabled
+}
+
+// PadCompression returns a shallow copy of r whose context tells GetWriter to
+// add between 1 and max bytes of random padding to the compressed response.
+//
+// The padding is put in a subfield of the gzip header's extra field, so it
+// doesn't change the content of the response once decompressed; it makes the
+// compressed length less useful to BREACH attacks. The max is capped at 65531
+// bytes.
+func PadCompression(r *http.Request, max int) *http.Request {
+	if max > maxPadding {
+		max = maxPadding
+	}
+	return r.WithContext(context.WithValue(r.Context(), compressionPaddingKey, max))
+}
+
+func compressionPadding(r *http.Request) int {
+	max, _ := r.Context().Value(compressionPaddingKey).(int)
+	return max
+}
+
+// randomPadding returns a gzip extra field made of a single subfield with
+// between 1 and max random bytes.
+func randomPadding(max int) []byte {
+	var n [2]byte
+	rand.Read(n[:])
+	size := 1 + int(binary.BigEndian.Uint16(n[:]))%max
+	extra := make([]byte, 4+size)
+	extra[0], extra[1] = paddingSI1, paddingSI2
+	binary.LittleEndian.PutUint16(extra[2:4], uint16(size))
+	rand.Read(extra[4:])
+	return extra
+}
+
+// MaskSecret returns a masked version of the given secret, suitable for
+// inclusion in a compressed response, that's different each time it's
+// called. The secret can be recovered with UnmaskSecret.
+//
+// The secret is XORed with a random one-time pad, which is prepended to the
+// result, so the secret doesn't appear as a repeated string in the response
+// that could be detected by a BREACH attack.
+func MaskSecret(secret []byte) string {
+	masked := make([]byte, 2*len(secret))
+	pad := masked[:len(secret)]
+	rand.Read(pad)
+	for i, b := range secret {
+		masked[len(secret)+i] = b ^ pad[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+// UnmaskSecret recovers a secret masked with MaskSecret.
+func UnmaskSecret(masked string) ([]byte, error) {
+	b, err := base64.RawURLEncoding.DecodeString(masked)
+	if err != nil {
+		return nil, err
+	}
+	if len(b)%2 != 0 {
+		return nil, errors.New("encneg: malformed masked secret")
+	}
+	n := len(b) / 2
+	secret := make([]byte, n)
+	for i := range secret {
+		secret[i] = b[i] ^ b[n+i]
+	}
+	return secret, nil
+}
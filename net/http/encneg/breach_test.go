@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDisableCompression(t *testing.T) {
+	req := httptest.NewRequest("", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req = DisableCompression(req)
+	rec := httptest.NewRecorder()
+	w := GetWriter(rec, req)
+
+	if w != rec {
+		t.Errorf("GetWriter didn't return the http.ResponseWriter directly")
+	}
+	if g := rec.Header().Get("Content-Encoding"); g != "" {
+		t.Errorf("content-encoding = %q, want none", g)
+	}
+	if g, e := rec.Header().Get("Vary"), "Accept-Encoding"; g != e {
+		t.Errorf("vary = %q, want %q", g, e)
+	}
+}
+
+func TestPadCompression(t *testing.T) {
+	sizes := make(map[int]bool)
+	for i := 0; i < 20; i++ {
+		req := httptest.NewRequest("", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		req = PadCompression(req, 32)
+		rec := httptest.NewRecorder()
+		w := GetWriter(rec, req)
+		io.WriteString(w, "Hello World!")
+		w.(io.Closer).Close()
+
+		r, err := gzip.NewReader(rec.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A single subfield (RFC 1952, Section 2.3.1.1)
+		extra := r.Header.Extra
+		if len(extra) < 4 || extra[0] != paddingSI1 || extra[1] != paddingSI2 {
+			t.Fatalf("extra field = %q, want a padding subfield", extra)
+		}
+		n := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if n != len(extra)-4 {
+			t.Errorf("subfield length = %d, want %d", n, len(extra)-4)
+		}
+		if n < 1 || n > 32 {
+			t.Errorf("padding = %d bytes, want between 1 and 32", n)
+		}
+		if b, err := io.ReadAll(r); err != nil {
+			t.Error(err)
+		} else if g, e := string(b), "Hello World!"; g != e {
+			t.Errorf("body = %q, want %q", g, e)
+		}
+		sizes[len(r.Header.Extra)] = true
+	}
+	if len(sizes) < 2 {
+		t.Errorf("padding length is not random")
+	}
+}
+
+func TestMaskSecret(t *testing.T) {
+	secret := []byte("s3cr3t-t0k3n")
+	m1, m2 := MaskSecret(secret), MaskSecret(secret)
+	if m1 == m2 {
+		t.Errorf("masked secrets are not different: %q", m1)
+	}
+	for _, m := range []string{m1, m2} {
+		if s, err := UnmaskSecret(m); err != nil {
+			t.Error(err)
+		} else if g, e := string(s), string(secret); g != e {
+			t.Errorf("unmasked = %q, want %q", g, e)
+		}
+	}
+	if _, err := UnmaskSecret("abcd"); err == nil {
+		t.Errorf("expected error for malformed masked secret")
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// A Coding describes how to decode and encode a content coding.
+//
+// Only gzip and deflate are registered by default, as they're the only
+// codings supported by the standard library. The br and zstd codings are
+// registered by importing the go.ltgt.net/net/http/encneg/br and
+// go.ltgt.net/net/http/encneg/zstd packages, respectively:
+//
+//	import _ "go.ltgt.net/net/http/encneg/zstd"
+//
+// Other codings can be registered with RegisterCoding.
+type Coding struct {
+	// NewReader returns an io.ReadCloser that decodes r.
+	// Closing the returned reader must not close r.
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+
+	// NewWriter returns an io.WriteCloser that encodes to w.
+	// It may be nil if the coding is only used for decoding.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+var (
+	codingsMu sync.RWMutex
+	codings   = map[string]Coding{
+		"gzip": {
+			NewReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriter(w), nil },
+		},
+		// Note: HTTP's deflate is actually the zlib format (RFC 1950),
+		// not a raw deflate stream (RFC 1951).
+		"deflate": {
+			NewReader: zlib.NewReader,
+			NewWriter: func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriter(w), nil },
+		},
+	}
+)
+
+// codingPreference is the order in which codings are preferred, when
+// available. Codings not listed here come last, in alphabetical order.
+var codingPreference = []string{"br", "zstd", "gzip", "deflate"}
+
+// RegisterCoding registers the given content coding, replacing any coding
+// previously registered with the same name. Coding names are
+// case-insensitive.
+func RegisterCoding(name string, c Coding) {
+	codingsMu.Lock()
+	defer codingsMu.Unlock()
+	codings[strings.ToLower(name)] = c
+}
+
+func lookupCoding(name string) (Coding, bool) {
+	codingsMu.RLock()
+	defer codingsMu.RUnlock()
+	c, ok := codings[strings.ToLower(name)]
+	return c, ok && c.NewReader != nil
+}
+
+// registeredCodings returns the names of the registered codings that can be
+// decoded, in order of preference.
+func registeredCodings() []string {
+	codingsMu.RLock()
+	defer codingsMu.RUnlock()
+	names := make([]string, 0, len(codings))
+	for name, c := range codings {
+		if c.NewReader != nil {
+			names = append(names, name)
+		}
+	}
+	sortCodings(names)
+	return names
+}
+
+// supportedCodings returns the names in cs that have been registered.
+func supportedCodings(cs []string) []string {
+	var names []string
+	for _, c := range cs {
+		if _, ok := lookupCoding(c); ok {
+			names = append(names, c)
+		}
+	}
+	return names
+}
+
+// sortCodings sorts names in place according to codingPreference.
+func sortCodings(names []string) {
+	rank := func(name string) int {
+		for i, p := range codingPreference {
+			if p == name {
+				return i
+			}
+		}
+		return len(codingPreference)
+	}
+	// Insertion sort: lists of codings are very short.
+	for i := 1; i < len(names); i++ {
+		for j := i; j > 0; j-- {
+			ri, rj := rank(names[j]), rank(names[j-1])
+			if ri > rj || (ri == rj && names[j] >= names[j-1]) {
+				break
+			}
+			names[j], names[j-1] = names[j-1], names[j]
+		}
+	}
+}
+
+// parseCodings splits a Content-Encoding header value into its (lowercased)
+// codings, in the order they were applied, omitting identity.
+func parseCodings(header string) []string {
+	var cs []string
+	for _, c := range strings.Split(header, ",") {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != "" && c != "identity" {
+			cs = append(cs, c)
+		}
+	}
+	return cs
+}
+
+// ErrRatioExceeded is returned when reading a decoded stream whose
+// decompression ratio exceeds the configured maximum.
+var ErrRatioExceeded = errors.New("encneg: decompression ratio exceeded")
+
+// ErrSizeExceeded is returned when reading a decoded stream whose decoded
+// size exceeds the configured maximum.
+var ErrSizeExceeded = errors.New("encneg: decoded size exceeded")
+
+// minRatioCheck is the number of decoded bytes after which the decompression
+// ratio starts being checked; small inputs legitimately have high ratios.
+const minRatioCheck = 64 << 10
+
+// newDecoder returns an io.ReadCloser that decodes r according to the given
+// codings (in the order they were applied), enforcing the given limits on the
+// decoded size and decompression ratio (zero meaning no limit.)
+// Codings are looked up with the lookup function.
+//
+// Nothing is read from r until the first call to Read: most decoders (such as
+// gzip's) read a header as soon as they're created, which would block on slow
+// streams and fail on empty ones.
+//
+// Closing the returned reader closes r.
+func newDecoder(r io.ReadCloser, cs []string, lookup func(string) (Coding, bool), maxSize int64, maxRatio int) (io.ReadCloser, error) {
+	d := &decoder{src: &countingReader{r: r}, maxSize: maxSize, maxRatio: int64(maxRatio), closers: []io.Closer{r}}
+	for i := len(cs) - 1; i >= 0; i-- {
+		c, ok := lookup(cs[i])
+		if !ok {
+			d.Close()
+			return nil, errors.New("encneg: unsupported content coding " + cs[i])
+		}
+		d.codings = append(d.codings, c)
+	}
+	return d, nil
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type decoder struct {
+	r        io.Reader
+	src      *countingReader
+	codings  []Coding // in decoding order
+	n        int64
+	maxSize  int64
+	maxRatio int64
+	closers  []io.Closer
+	err      error
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	if d.err != nil {
+		return 0, d.err
+	}
+	if d.r == nil {
+		if d.err = d.init(); d.err != nil {
+			return 0, d.err
+		}
+	}
+	n, err := d.r.Read(p)
+	d.n += int64(n)
+	if d.maxSize > 0 && d.n > d.maxSize {
+		d.err = ErrSizeExceeded
+	} else if d.maxRatio > 0 && d.n > minRatioCheck && d.n > d.maxRatio*d.src.n {
+		d.err = ErrRatioExceeded
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return n, err
+}
+
+// init creates the chain of decoding readers.
+func (d *decoder) init() error {
+	var cur io.Reader = d.src
+	for _, c := range d.codings {
+		rc, err := c.NewReader(cur)
+		if err != nil {
+			return err
+		}
+		d.closers = append(d.closers, rc)
+		cur = rc
+	}
+	d.r = cur
+	return nil
+}
+
+func (d *decoder) Close() error {
+	var err error
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		if e := d.closers[i].Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
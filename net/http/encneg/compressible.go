@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+var compressibleKey = &contextKey{"compressible"}
+
+// WithCompressible returns a shallow copy of r whose context tells GetWriter
+// to only compress responses whose Content-Type is accepted by the given
+// function, instead of DefaultCompressible:
+//
+//	r = encneg.WithCompressible(r, func(ct string) bool {
+//		return !strings.HasPrefix(ct, "application/x-ndjson") && encneg.DefaultCompressible(ct)
+//	})
+//	gw := encneg.GetWriter(w, r)
+func WithCompressible(r *http.Request, compressible func(contentType string) bool) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), compressibleKey, compressible))
+}
+
+func compressibleFunc(r *http.Request) func(string) bool {
+	if f, _ := r.Context().Value(compressibleKey).(func(string) bool); f != nil {
+		return f
+	}
+	return DefaultCompressible
+}
+
+// compressibleTypes are the media types, outside the text/* tree and the
+// +json and +xml structured syntax suffixes, that are worth compressing.
+var compressibleTypes = map[string]bool{
+	"application/ecmascript":        true,
+	"application/graphql":           true,
+	"application/javascript":        true,
+	"application/json":              true,
+	"application/rtf":               true,
+	"application/vnd.ms-fontobject": true,
+	"application/wasm":              true,
+	"application/x-javascript":      true,
+	"application/x-ndjson":          true,
+	"application/x-sh":              true,
+	"application/xml":               true,
+	"font/otf":                      true,
+	"font/ttf":                      true,
+	"image/bmp":                     true,
+	"image/vnd.microsoft.icon":      true,
+	"image/x-icon":                  true,
+}
+
+// DefaultCompressible reports whether content with the given Content-Type
+// is worth compressing: text formats (text/*, JSON, XML, JavaScript, SVG…)
+// and a few uncompressed binary formats (such as WebAssembly and TrueType
+// fonts) are; already compressed formats (most images, audio and video,
+// WOFF fonts, archives…) and unknown types aren't.
+//
+// Parameters (such as charset) are ignored; an empty Content-Type is not
+// compressible.
+func DefaultCompressible(contentType string) bool {
+	mediaType := contentType
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return strings.HasPrefix(mediaType, "text/") ||
+		strings.HasSuffix(mediaType, "+json") ||
+		strings.HasSuffix(mediaType, "+xml") ||
+		compressibleTypes[mediaType]
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func TestDefaultCompressible(t *testing.T) {
+	for _, tt := range []struct {
+		contentType string
+		want        bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"Text/CSS", true},
+		{"application/json", true},
+		{"application/problem+json", true},
+		{"application/atom+xml; charset=utf-8", true},
+		{"image/svg+xml", true},
+		{"application/wasm", true},
+		{"text/javascript", true},
+		{"image/png", false},
+		{"image/webp", false},
+		{"video/mp4", false},
+		{"font/woff2", false},
+		{"application/zip", false},
+		{"application/gzip", false},
+		{"application/octet-stream", false},
+		{"", false},
+	} {
+		if g, e := DefaultCompressible(tt.contentType), tt.want; g != e {
+			t.Errorf("test %s: compressible = %t, want %t", tt.contentType, g, e)
+		}
+	}
+}
+
+func TestGetWriterCompressible(t *testing.T) {
+	onlyJSON := func(ct string) bool { return ct == "application/json" }
+	for _, tt := range []struct {
+		contentType  string
+		compressible func(string) bool
+		wantGzip     bool
+	}{
+		{"", nil, true},
+		{"application/json", nil, true},
+		{"image/png", nil, false},
+		{"application/zip", nil, false},
+		{"application/json", onlyJSON, true},
+		{"text/html", onlyJSON, false},
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		if tt.compressible != nil {
+			req = WithCompressible(req, tt.compressible)
+		}
+		rec := httptest.NewRecorder()
+		if tt.contentType != "" {
+			rec.Header().Set("Content-Type", tt.contentType)
+		}
+		w := GetWriter(rec, req)
+		if g, e := w != rec, tt.wantGzip; g != e {
+			t.Errorf("test %s[%t]: compressed = %t, want %t", tt.contentType, tt.compressible != nil, g, e)
+		}
+	}
+}
+
+func TestFileServerCompressible(t *testing.T) {
+	root := httpfs.New(mapfs.New(map[string]string{
+		"logo.png":    "\x89PNG\r\n\x1a\n",
+		"logo.png.gz": string(encode(t, "gzip", []byte("\x89PNG\r\n\x1a\n"))),
+		"app.js":      "alert(1)",
+		"app.js.gz":   string(encode(t, "gzip", []byte("alert(1)"))),
+	}))
+	for _, tt := range []struct {
+		compressible        func(string) bool
+		path                string
+		wantContentEncoding string
+	}{
+		// Existing variants are served by default
+		{nil, "/logo.png", "gzip"},
+		{nil, "/app.js", "gzip"},
+		{DefaultCompressible, "/logo.png", ""},
+		{DefaultCompressible, "/app.js", "gzip"},
+		{DefaultCompressible, "/logo.png.gz", "gzip"},
+	} {
+		h := &FileHandler{Root: root, Compressible: tt.compressible}
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s[%t]: content-encoding = %q, want %q", tt.path, tt.compressible != nil, g, e)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxSize is the maximum decoded size of request bodies used by
+// DecodeRequest when DecodeOptions.MaxSize is zero.
+const DefaultMaxSize = 32 << 20
+
+// DecodeOptions configure the DecodeRequest middleware.
+type DecodeOptions struct {
+	// Codings lists the accepted codings; codings that haven't been
+	// registered are ignored.
+	// If nil, all the registered codings are accepted (see RegisterCoding.)
+	Codings []string
+
+	// MaxSize is the maximum decoded size of request bodies.
+	// Reading a request body exceeding that size fails with
+	// ErrSizeExceeded.
+	// If zero, DefaultMaxSize is used; if negative, there's no limit.
+	MaxSize int64
+
+	// MaxRatio is the maximum allowed ratio of decoded to encoded bytes.
+	// Reading a request body exceeding that ratio fails with
+	// ErrRatioExceeded.
+	// If zero, DefaultMaxRatio is used; if negative, there's no limit.
+	MaxRatio int
+
+	// Keys, if non-nil, enables the aes128gcm coding (RFC 8188), returning
+	// the input keying material for the key ID of the request body.
+	// See NewAES128GCMReader.
+	Keys func(keyID []byte) ([]byte, error)
+}
+
+// DecodeRequest wraps an http.Handler to decode request bodies sent with a
+// Content-Encoding.
+//
+// The wrapped handler sees a request without Content-Encoding and
+// Content-Length headers, whose Body is the decoded body; reading that body
+// fails with ErrSizeExceeded or ErrRatioExceeded when the limits configured
+// in opts are exceeded, or with the decoding error when the body is
+// malformed. A nil opts uses the defaults.
+//
+// Requests without a body are passed as-is to the wrapped handler.
+// Requests using an unsupported coding are rejected with a
+// 415 (Unsupported Media Type) status code and an Accept-Encoding response
+// header listing the supported codings, as defined in RFC 7694.
+func DecodeRequest(h http.Handler, opts *DecodeOptions) http.Handler {
+	if opts == nil {
+		opts = &DecodeOptions{}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		applied := parseCodings(r.Header.Get("Content-Encoding"))
+		if len(applied) == 0 || r.Body == nil || r.Body == http.NoBody || r.ContentLength == 0 {
+			// Nothing to decode
+			h.ServeHTTP(w, r)
+			return
+		}
+		cs := registeredCodings()
+		if opts.Codings != nil {
+			cs = supportedCodings(opts.Codings)
+		}
+		if opts.Keys != nil {
+			cs = append(cs, "aes128gcm")
+		}
+		for _, c := range applied {
+			if !contains(cs, c) {
+				w.Header().Set("Accept-Encoding", strings.Join(cs, ", "))
+				http.Error(w, "Unsupported content coding: "+c, http.StatusUnsupportedMediaType)
+				return
+			}
+		}
+		maxSize, maxRatio := opts.MaxSize, opts.MaxRatio
+		if maxSize == 0 {
+			maxSize = DefaultMaxSize
+		} else if maxSize < 0 {
+			maxSize = 0
+		}
+		if maxRatio == 0 {
+			maxRatio = DefaultMaxRatio
+		} else if maxRatio < 0 {
+			maxRatio = 0
+		}
+		body, err := newDecoder(r.Body, applied, opts.lookupCoding, maxSize, maxRatio)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		r2 := cloneRequest(r)
+		r2.Body = body
+		r2.ContentLength = -1
+		r2.Header.Del("Content-Encoding")
+		r2.Header.Del("Content-Length")
+		h.ServeHTTP(w, r2)
+	})
+}
+
+func (opts *DecodeOptions) lookupCoding(name string) (Coding, bool) {
+	if opts.Keys != nil && strings.EqualFold(name, "aes128gcm") {
+		return Coding{
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return io.NopCloser(NewAES128GCMReader(r, opts.Keys)), nil
+			},
+		}, true
+	}
+	return lookupCoding(name)
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	const content = `{"hello":"world"}`
+	var gotBody, gotCE, gotCL string
+	var gotErr error
+	handler := DecodeRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		gotBody, gotErr = string(b), err
+		gotCE, gotCL = r.Header.Get("Content-Encoding"), r.Header.Get("Content-Length")
+	}), &DecodeOptions{Codings: []string{"gzip", "deflate", "br"}})
+
+	testData := []struct {
+		contentEncoding string
+		body            []byte
+		wantCode        int
+		wantAE          string
+		wantErr         bool
+	}{
+		{"", []byte(content), http.StatusOK, "", false},
+		{"identity", []byte(content), http.StatusOK, "", false},
+		{"gzip", encode(t, "gzip", []byte(content)), http.StatusOK, "", false},
+		{"GZIP", encode(t, "gzip", []byte(content)), http.StatusOK, "", false},
+		{"deflate", encode(t, "deflate", []byte(content)), http.StatusOK, "", false},
+		{"gzip, deflate", encode(t, "deflate", encode(t, "gzip", []byte(content))), http.StatusOK, "", false},
+		// The handler sees the decoding error
+		{"gzip", []byte(content), http.StatusOK, "", true},
+		// br is not registered
+		{"br", []byte(content), http.StatusUnsupportedMediaType, "gzip, deflate", false},
+		{"compress", []byte(content), http.StatusUnsupportedMediaType, "gzip, deflate", false},
+		{"gzip, compress", []byte(content), http.StatusUnsupportedMediaType, "gzip, deflate", false},
+	}
+	for _, tt := range testData {
+		gotBody, gotErr, gotCE, gotCL = "", nil, "", ""
+
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(tt.body))
+		if tt.contentEncoding != "" {
+			req.Header.Set("Content-Encoding", tt.contentEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %q: status = %d, want %d", tt.contentEncoding, g, e)
+		}
+		if g, e := rec.Header().Get("Accept-Encoding"), tt.wantAE; g != e {
+			t.Errorf("test %q: accept-encoding = %q, want %q", tt.contentEncoding, g, e)
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+		if tt.wantErr {
+			if gotErr == nil {
+				t.Errorf("test %q: expected a decoding error", tt.contentEncoding)
+			}
+			continue
+		}
+		if gotErr != nil {
+			t.Errorf("test %q: %v", tt.contentEncoding, gotErr)
+		}
+		if g, e := gotBody, content; g != e {
+			t.Errorf("test %q: body = %q, want %q", tt.contentEncoding, g, e)
+		}
+		if tt.contentEncoding != "" && tt.contentEncoding != "identity" && (gotCE != "" || gotCL != "") {
+			t.Errorf("test %q: content-encoding = %q, content-length = %q; want none", tt.contentEncoding, gotCE, gotCL)
+		}
+	}
+}
+
+func TestDecodeRequestEmptyBody(t *testing.T) {
+	var called bool
+	var gotErr error
+	var gotCE string
+	handler := DecodeRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		_, gotErr = io.ReadAll(r.Body)
+		gotCE = r.Header.Get("Content-Encoding")
+	}), nil)
+
+	for _, body := range []io.Reader{nil, http.NoBody, bytes.NewReader(nil)} {
+		called, gotErr, gotCE = false, nil, ""
+		req := httptest.NewRequest("POST", "/", body)
+		req.Header.Set("Content-Encoding", "gzip")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if g, e := rec.Code, http.StatusOK; g != e {
+			t.Errorf("test %T: status = %d, want %d", body, g, e)
+		}
+		if !called {
+			t.Errorf("test %T: handler not called", body)
+		}
+		if gotErr != nil {
+			t.Errorf("test %T: %v", body, gotErr)
+		}
+		if g, e := gotCE, "gzip"; g != e {
+			t.Errorf("test %T: content-encoding = %q, want %q (untouched request)", body, g, e)
+		}
+	}
+
+	// Lazily decoded: the handler is called before the body is read.
+	called = false
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	req := httptest.NewRequest("POST", "/", pr)
+	req.Header.Set("Content-Encoding", "gzip")
+	DecodeRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}), nil).ServeHTTP(httptest.NewRecorder(), req)
+	if !called {
+		t.Errorf("handler not called before the body is sent")
+	}
+}
+
+func TestDecodeRequestLimits(t *testing.T) {
+	var gotErr error
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, gotErr = io.ReadAll(r.Body)
+	})
+	bomb := encode(t, "gzip", make([]byte, 10<<20))
+
+	testData := []struct {
+		opts    *DecodeOptions
+		wantErr error
+	}{
+		{nil, ErrRatioExceeded},
+		{&DecodeOptions{MaxSize: 1 << 20, MaxRatio: -1}, ErrSizeExceeded},
+		{&DecodeOptions{MaxSize: -1, MaxRatio: -1}, nil},
+		{&DecodeOptions{MaxRatio: 100000}, nil},
+	}
+	for i, tt := range testData {
+		gotErr = nil
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(bomb))
+		req.Header.Set("Content-Encoding", "gzip")
+		DecodeRequest(handler, tt.opts).ServeHTTP(httptest.NewRecorder(), req)
+
+		if g, e := gotErr, tt.wantErr; g != e {
+			t.Errorf("test %d: err = %v, want %v", i, g, e)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// dictionaryCodings are the content codings using a compression dictionary,
+// as defined by RFC 9842, in order of preference.
+var dictionaryCodings = []string{"dcb", "dcz"}
+
+func isDictionaryCoding(coding string) bool {
+	return coding == "dcb" || coding == "dcz"
+}
+
+// availableDictionary returns the lowercase hex-encoded SHA-256 hash of the
+// dictionary advertised in the Available-Dictionary request header, or an
+// empty string if there's none or it's malformed.
+func availableDictionary(h http.Header) string {
+	// The header value is a Structured Field Byte Sequence (RFC 8941)
+	v := strings.TrimSpace(h.Get("Available-Dictionary"))
+	if len(v) < 2 || v[0] != ':' || v[len(v)-1] != ':' {
+		return ""
+	}
+	hash, err := base64.StdEncoding.DecodeString(v[1 : len(v)-1])
+	if err != nil || len(hash) != sha256.Size {
+		return ""
+	}
+	return hex.EncodeToString(hash)
+}
@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func TestAvailableDictionary(t *testing.T) {
+	hash := sha256.Sum256([]byte("dictionary"))
+	for _, tt := range []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{":" + base64.StdEncoding.EncodeToString(hash[:]) + ":", hex.EncodeToString(hash[:])},
+		{" :" + base64.StdEncoding.EncodeToString(hash[:]) + ": ", hex.EncodeToString(hash[:])},
+		{base64.StdEncoding.EncodeToString(hash[:]), ""},
+		{":" + base64.StdEncoding.EncodeToString(hash[:16]) + ":", ""},
+		{":not base64:", ""},
+	} {
+		h := http.Header{"Available-Dictionary": {tt.header}}
+		if g, e := availableDictionary(h), tt.want; g != e {
+			t.Errorf("test %q: hash = %q, want %q", tt.header, g, e)
+		}
+	}
+}
+
+func TestFileServerDictionaries(t *testing.T) {
+	dict := sha256.Sum256([]byte("app.v1.js"))
+	hash := hex.EncodeToString(dict[:])
+	availableDictionary := ":" + base64.StdEncoding.EncodeToString(dict[:]) + ":"
+	other := sha256.Sum256([]byte("app.v0.js"))
+	otherDictionary := ":" + base64.StdEncoding.EncodeToString(other[:]) + ":"
+
+	fs := &FileHandler{
+		Root: httpfs.New(mapfs.New(map[string]string{
+			"app.v2.js":             "app.v2, uncompressed",
+			"app.v2.js.br":          "app.v2, brotli",
+			"app.v2.js.dcb." + hash: "app.v2, brotli with app.v1 dictionary",
+			"app.v2.js.dcz." + hash: "app.v2, zstd with app.v1 dictionary",
+		})),
+		UseAsDictionary: func(path string) string {
+			if strings.HasPrefix(path, "/app.") && strings.HasSuffix(path, ".js") {
+				return `match="/app.*.js"`
+			}
+			return ""
+		},
+	}
+
+	testData := []struct {
+		acceptEncoding      string
+		availableDictionary string
+		wantContentEncoding string
+		wantVary            []string
+	}{
+		{"br", "", "br", []string{"Accept-Encoding"}},
+		{"br, dcb, dcz", "", "br", []string{"Accept-Encoding"}},
+		{"br, dcb, dcz", availableDictionary, "dcb", []string{"Accept-Encoding", "Available-Dictionary"}},
+		{"br, dcz", availableDictionary, "dcz", []string{"Accept-Encoding", "Available-Dictionary"}},
+		{"br", availableDictionary, "br", []string{"Accept-Encoding"}},
+		{"br, dcb, dcz", otherDictionary, "br", []string{"Accept-Encoding"}},
+	}
+	for _, tt := range testData {
+		req := httptest.NewRequest("GET", "/app.v2.js", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		if tt.availableDictionary != "" {
+			req.Header.Set("Available-Dictionary", tt.availableDictionary)
+		}
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+
+		test := "[" + tt.acceptEncoding + "][" + tt.availableDictionary + "]"
+		if g, e := rec.Code, http.StatusOK; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header()["Vary"], tt.wantVary; !areEqual(g, e) {
+			t.Errorf("test %s: vary = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Use-As-Dictionary"), `match="/app.*.js"`; g != e {
+			t.Errorf("test %s: use-as-dictionary = %q, want %q", test, g, e)
+		}
+	}
+
+	// Only on successful responses
+	req := httptest.NewRequest("GET", "/app.v3.js", nil)
+	rec := httptest.NewRecorder()
+	fs.ServeHTTP(rec, req)
+	if g := rec.Header().Get("Use-As-Dictionary"); g != "" {
+		t.Errorf("test 404: use-as-dictionary = %q, want none", g)
+	}
+}
+
+func areEqual(g, e []string) bool {
+	if len(g) != len(e) {
+		return false
+	}
+	for i, v := range g {
+		if v != e[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"time"
+)
+
+// Keys of the digests cache are prefixed by the file system the file is in.
+const (
+	rootDigestKey     = "root:"
+	variantsDigestKey = "variants:"
+)
+
+var errNotRegular = errors.New("encneg: not a regular file")
+
+type fileDigest struct {
+	modtime time.Time
+	size    int64
+	sha256  []byte
+	sha384  []byte
+}
+
+// header returns the value for the Repr-Digest or Content-Digest header.
+func (d *fileDigest) header() string {
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(d.sha256) + ":"
+}
+
+// Integrity returns the Subresource Integrity metadata for the file at the
+// given path in Root, for use as the value of an integrity attribute, such
+// as "sha384-…". If a Manifest is configured, the path can also be
+// a logical asset name.
+//
+// It is meant to be used as a template function, alongside the Manifest's
+// AssetURL:
+//
+//	t := template.New("page").Funcs(template.FuncMap{
+//		"asset":     manifest.AssetURL,
+//		"integrity": fileHandler.Integrity,
+//	})
+//
+//	<script src="{{asset "app.js"}}" integrity="{{integrity "app.js"}}"></script>
+func (f *FileHandler) Integrity(name string) (string, error) {
+	if file, ok := f.Manifest.lookup(name); ok {
+		name = file
+	}
+	d, err := f.digest(f.Root, rootDigestKey, path.Join("/", name))
+	if err != nil {
+		return "", err
+	}
+	return "sha384-" + base64.StdEncoding.EncodeToString(d.sha384), nil
+}
+
+// withDigests wraps w to send a Repr-Digest header for the named file on
+// successful responses, and a Content-Digest header on full responses,
+// if Digests are enabled.
+func (f *FileHandler) withDigests(w http.ResponseWriter, fsys http.FileSystem, key, name string) http.ResponseWriter {
+	if !f.Digests {
+		return w
+	}
+	d, err := f.digest(fsys, key, name)
+	if err != nil {
+		return w
+	}
+	return &responseWithHeaders{
+		w:        w,
+		header:   http.Header{"Repr-Digest": {d.header()}},
+		okHeader: http.Header{"Content-Digest": {d.header()}},
+	}
+}
+
+// digest returns the digests of the named file, from the cache if it's still
+// up-to-date.
+func (f *FileHandler) digest(fsys http.FileSystem, key, name string) (*fileDigest, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, errNotRegular
+	}
+	key += name
+
+	f.digestsMu.Lock()
+	d := f.digests[key]
+	f.digestsMu.Unlock()
+	if d != nil && d.modtime.Equal(fi.ModTime()) && d.size == fi.Size() {
+		return d, nil
+	}
+
+	h256, h384 := sha256.New(), sha512.New384()
+	if _, err := io.Copy(io.MultiWriter(h256, h384), file); err != nil {
+		return nil, err
+	}
+	d = &fileDigest{
+		modtime: fi.ModTime(),
+		size:    fi.Size(),
+		sha256:  h256.Sum(nil),
+		sha384:  h384.Sum(nil),
+	}
+	f.digestsMu.Lock()
+	if f.digests == nil {
+		f.digests = make(map[string]*fileDigest)
+	}
+	f.digests[key] = d
+	f.digestsMu.Unlock()
+	return d, nil
+}
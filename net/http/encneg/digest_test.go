@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func sha256Digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":"
+}
+
+func TestFileServerDigests(t *testing.T) {
+	h := &FileHandler{Root: fs.(*FileHandler).Root, Digests: true}
+	identity := sha256Digest(fsmap["with.br.and.gz/foo.html"])
+	gz := sha256Digest(fsmap["with.br.and.gz/foo.html.gz"])
+	br := sha256Digest(fsmap["with.br.and.gz/foo.html.br"])
+
+	// The representation data is content-coded, so Repr-Digest is that of
+	// the variant.
+	for _, tt := range []struct {
+		path, acceptEncoding, rangeHeader string
+		wantCode                          int
+		wantReprDigest                    string
+		wantContentDigest                 string
+	}{
+		{"/with.br.and.gz/foo.html", "", "", http.StatusOK, identity, identity},
+		{"/with.br.and.gz/foo.html", "gzip", "", http.StatusOK, gz, gz},
+		{"/with.br.and.gz/foo.html", "br, gzip", "", http.StatusOK, br, br},
+		{"/with.br.and.gz/foo.html.br", "br", "", http.StatusOK, br, br},
+		// Content-Digest is only sent for the full content
+		{"/with.br.and.gz/foo.html", "gzip", "bytes=0-1", http.StatusPartialContent, gz, ""},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		if tt.rangeHeader != "" {
+			req.Header.Set("Range", tt.rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]" + tt.rangeHeader
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Repr-Digest"), tt.wantReprDigest; g != e {
+			t.Errorf("test %s: repr-digest = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Digest"), tt.wantContentDigest; g != e {
+			t.Errorf("test %s: content-digest = %q, want %q", test, g, e)
+		}
+	}
+
+	// Disabled by default
+	req := httptest.NewRequest("GET", "/with.br.and.gz/foo.html", nil)
+	rec := httptest.NewRecorder()
+	fs.ServeHTTP(rec, req)
+	if g := rec.Header().Get("Repr-Digest"); g != "" {
+		t.Errorf("test disabled: repr-digest = %q, want none", g)
+	}
+}
+
+func TestFileHandlerIntegrity(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(`{"foo.js": "foo.123abc.js"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"foo.123abc.js": "console.log('foo')",
+		"bar.js":        "console.log('bar')",
+	}
+	h := &FileHandler{Root: httpfs.New(mapfs.New(files)), Manifest: m}
+	for _, tt := range []struct{ name, file string }{
+		{"foo.js", "foo.123abc.js"},
+		{"/foo.js", "foo.123abc.js"},
+		{"bar.js", "bar.js"},
+		{"/bar.js", "bar.js"},
+	} {
+		sum := sha512.Sum384([]byte(files[tt.file]))
+		want := "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+		if g, err := h.Integrity(tt.name); err != nil {
+			t.Errorf("test %s: %v", tt.name, err)
+		} else if g != want {
+			t.Errorf("test %s: integrity = %q, want %q", tt.name, g, want)
+		}
+	}
+	if _, err := h.Integrity("missing.js"); err == nil {
+		t.Errorf("test missing.js: expected error")
+	}
+}
@@ -7,7 +7,15 @@
 // well as a helper to do on-the-fly compression when needed.
 //
 // The FileServer detects both Brotli and Gzip (Zopfli?) precompressed files,
+// as well as files precompressed with a shared dictionary (RFC 9842),
 // whereas the GetWriter helper only does streaming Gzip compression.
+// ServeVariants serves precompressed variants held in memory, and
+// ZipFileServer serves the Deflate-compressed entries of ZIP archives
+// without recompressing them.
+//
+// On the client side, Transport negotiates and decodes content codings from
+// a registry that can be extended with RegisterCoding. That same registry is
+// used by the DecodeRequest middleware to decode request bodies.
 //
 // The package does not provide a http.Handler middleware for on-the-fly
 // compression because a middleware cannot detect cases where compression would
@@ -18,10 +26,11 @@ package encneg // import "go.ltgt.net/net/http/encneg"
 import (
 	"compress/gzip"
 	"io"
-	"mime"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 var encodingByExtensionMap = map[string]string{
@@ -29,10 +38,6 @@ var encodingByExtensionMap = map[string]string{
 	".gz": "gzip",
 }
 
-type fileHandler struct {
-	fs http.Handler
-}
-
 // FileServer returns a handler that serves HTTP requests
 // with the contents of the file system rooted at root,
 // negotiating the content encoding based on whether a
@@ -47,66 +52,337 @@ type fileHandler struct {
 // ending in "/index.html" to the same path, without the final
 // "index.html"; just like the standard http.FileServer.
 func FileServer(root http.FileSystem) http.Handler {
-	return &fileHandler{fs: http.FileServer(root)}
+	return &FileHandler{Root: root}
 }
 
-func (f *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// A FileHandler is an http.Handler that serves HTTP requests with the contents
+// of a file system, negotiating the content encoding based on whether a
+// precompressed variant of the requested file exists.
+//
+// FileServer returns a FileHandler whose only field set is Root. Other fields
+// can be set by creating the FileHandler directly:
+//
+//	http.Handle("/", &encneg.FileHandler{
+//		Root:     http.FS(assets),
+//		Variants: http.Dir("/var/cache/assets"),
+//	})
+type FileHandler struct {
+	// Root is the file system containing the files to serve.
+	Root http.FileSystem
+
+	// Variants is the file system where precompressed variants are looked
+	// up, using the same path as the original file in Root with an added
+	// extension (such as /css/site.css.br for /css/site.css.)
+	// This allows keeping variants out of the original files' tree, such as
+	// when Root is read-only.
+	// If nil, variants are looked up in Root, next to the original files.
+	// Files requested directly (such as /css/site.css.br) are looked up in
+	// Variants first, then in Root.
+	Variants http.FileSystem
+
+	// RangePolicy determines how range requests are served.
+	RangePolicy RangePolicy
+
+	// UseAsDictionary, if non-nil, returns the value of the Use-As-Dictionary
+	// response header (RFC 9842) for the file at the given path, such as
+	// `match="/js/app.*.js"`, or an empty string if the file is not meant to
+	// be used as a compression dictionary.
+	//
+	// Independently of this field, variants compressed with a dictionary
+	// are negotiated whenever the request has an Available-Dictionary header
+	// and accepts the dcb or dcz coding; such variants are looked up with an
+	// extension made of the coding and the lowercase hex-encoded SHA-256 hash
+	// of the dictionary (such as /js/app.v2.js.dcz.<hash>.)
+	UseAsDictionary func(path string) string
+
+	// Rules configure how files are served depending on their path.
+	// The first rule matching the path of the requested file (excluding
+	// any extension for precompressed variants) applies.
+	Rules []Rule
+
+	// Manifest, if non-nil, lists fingerprinted files, that are served with
+	// a long-lived immutable caching (see ImmutableCacheControl), unless a
+	// matching rule sets its own CacheControl.
+	Manifest *Manifest
+
+	// Digests enables sending the SHA-256 digests of the files, as defined
+	// in RFC 9530. As the representation data includes the content coding,
+	// both the Repr-Digest and Content-Digest response headers have the
+	// digest of the file actually sent, be it the original file or
+	// a precompressed variant; Content-Digest is only sent on full
+	// responses though, as it would be that of the range otherwise.
+	//
+	// Digests are computed on first use and cached, and recomputed whenever
+	// the files' modification time or size change.
+	// Integrity can be used independently of this field.
+	Digests bool
+
+	// Types maps file extensions (including the leading dot, such as
+	// ".js") to media types, overriding the built-in table used to set
+	// the Content-Type. The built-in table doesn't depend on the host's
+	// mime.types files, contrary to mime.TypeByExtension.
+	// Files whose extension is in neither table get their Content-Type
+	// sniffed from their (decompressed) content.
+	Types map[string]string
+
+	// Compressible, if not nil, tells which media types are worth
+	// compressing: precompressed variants aren't looked up for files whose
+	// type is rejected (as determined from their extension, see Types),
+	// saving file system accesses. DefaultCompressible is a good choice.
+	// Files requested directly are always served.
+	//
+	// If nil, variants are looked up for all files.
+	Compressible func(contentType string) bool
+
+	digestsMu sync.Mutex
+	digests   map[string]*fileDigest
+}
+
+// A RangePolicy determines how a FileHandler serves range requests.
+//
+// Whatever the policy, each variant is sent with its own strong ETag, and
+// range requests with a date-based If-Range are served the full
+// representation when a variant could be selected, as the date cannot tell
+// variants apart.
+type RangePolicy int
+
+const (
+	// RangeAnyVariant applies ranges to the bytes of the negotiated
+	// variant, as http.FileServer would do.
+	RangeAnyVariant RangePolicy = iota
+
+	// RangeIdentity serves the identity variant to range requests,
+	// so that ranges always apply to the same bytes whatever the request's
+	// Accept-Encoding.
+	RangeIdentity
+)
+
+func (f *FileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	root, variants := f.Root, f.Variants
+	if variants == nil {
+		variants = root
+	}
+	fs, vfs := http.FileServer(root), http.FileServer(variants)
+
 	p := r.URL.Path
 	// Special-case /index.html: let http.FileServer do its redirect
 	if strings.HasSuffix(p, "/index.html") {
-		f.fs.ServeHTTP(w, r)
+		fs.ServeHTTP(w, r)
 		return
 	}
 	// Directly asked for a compressed file, set correct Content-* headers
 	ext := filepath.Ext(p)
 	if encoding := encodingByExtensionMap[ext]; encoding != "" {
-		f.serveCompressedFile(ext, encoding, r.URL.Path[:len(r.URL.Path)-len(ext)], false, w, r)
+		p = p[:len(p)-len(ext)]
+		rule := matchRule(f.Rules, p)
+		if rule != nil && rule.DenyVariants {
+			http.NotFound(w, r)
+			return
+		}
+		// Fall back to Root for files that aren't in the Variants file
+		// system, such as a /dl/archive.tar.gz download.
+		fsys, h, key := variants, vfs, variantsDigestKey
+		if f.Variants != nil && !isRegularFile(variants, p+ext) {
+			fsys, h, key = root, fs, rootDigestKey
+		}
+		w = f.withDigests(f.withHeaders(w, rule, p), fsys, key, p+ext)
+		f.serveCompressedFile(fsys, h, ext, encoding, p, false, w, r)
 		return
 	}
 
 	// Try variants successively, based on Accept-Encoding,
-	// prefering Brotli to Gzip.
+	// prefering dictionary-compressed variants, then Brotli to Gzip.
 	if strings.HasSuffix(p, "/") {
 		p += "index.html"
 	}
+	rule := matchRule(f.Rules, p)
+	w = f.withHeaders(w, rule, p)
 	ae := r.Header.Get("Accept-Encoding")
-	if hasToken(ae, "br") && f.tryServeCompressedFile(".br", "br", p, w, r) {
-		return
-	} else if hasToken(ae, "gzip") && f.tryServeCompressedFile(".gz", "gzip", p, w, r) {
-		return
+	if ct := f.typeByExtension(p); ct != "" && f.Compressible != nil && !f.Compressible(ct) {
+		// Don't bother looking for variants
+		ae = ""
+	}
+	accepts := func(coding string) bool {
+		return hasToken(ae, coding) && rule.allows(coding)
+	}
+	var candidates []variant
+	if hash := availableDictionary(r.Header); hash != "" {
+		for _, coding := range dictionaryCodings {
+			if accepts(coding) {
+				candidates = append(candidates, variant{"." + coding + "." + hash, coding})
+			}
+		}
+	}
+	if accepts("br") {
+		candidates = append(candidates, variant{".br", "br"})
+	}
+	if accepts("gzip") {
+		candidates = append(candidates, variant{".gz", "gzip"})
+	}
+	if r.Header.Get("Range") != "" {
+		if ir := r.Header.Get("If-Range"); ir != "" && !isETag(ir) {
+			// The date cannot tell variants apart, but it's fine for
+			// the identity representation when there's no variant.
+			if hasVariant(variants, p, candidates) {
+				r = cloneRequest(r)
+				r.Header.Del("Range")
+			}
+		} else if f.RangePolicy == RangeIdentity {
+			candidates = nil
+		}
+	}
+	for _, v := range candidates {
+		if f.tryServeCompressedFile(variants, vfs, v.ext, v.coding, p, w, r) {
+			return
+		}
+	}
+	if etag, _ := fileETag(root, p, ""); etag != "" {
+		w.Header().Set("Etag", etag)
 	}
 	// Note that this unconditionally sends a "Vary: Accept-Encoding" response
 	// header, whether there actually exist variants or not, because the cost
 	// of checking for a variant would outweight the implications of the Vary
 	// header (namely that intermediary caches will have to store one response
 	// per Accept-Encoding request header value).
-	f.fs.ServeHTTP(&responseWithContentEncoding{w: w, isConneg: true}, r)
+	// Never let http.FileServer use mime.TypeByExtension, which depends on
+	// the host's mime.types files.
+	ct := f.typeByExtension(p)
+	if ct == "" {
+		ct = sniffContentType(root, p, "")
+	}
+	if ct != "" {
+		w.Header().Set("Content-Type", ct)
+	}
+	fs.ServeHTTP(&responseWithContentEncoding{w: f.withDigests(w, root, rootDigestKey, p), isConneg: true}, r)
+}
+
+// A variant is a precompressed file, identified by the extension appended to
+// the path of the identity file, and its content coding.
+type variant struct {
+	ext, coding string
 }
 
-func (f *fileHandler) tryServeCompressedFile(ext, encoding, path string, w http.ResponseWriter, r *http.Request) bool {
+// hasVariant reports whether any of the candidate variants exists for the
+// file at path p.
+func hasVariant(fsys http.FileSystem, p string, candidates []variant) bool {
+	for _, v := range candidates {
+		if isRegularFile(fsys, p+v.ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isRegularFile reports whether the named file exists in fsys and is
+// a regular file.
+func isRegularFile(fsys http.FileSystem, name string) bool {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	return err == nil && fi.Mode().IsRegular()
+}
+
+// withHeaders wraps w to add the headers configured for the file at the
+// given path to successful responses.
+func (f *FileHandler) withHeaders(w http.ResponseWriter, rule *Rule, p string) http.ResponseWriter {
+	h := make(http.Header)
+	if f.UseAsDictionary != nil {
+		if v := f.UseAsDictionary(p); v != "" {
+			h.Set("Use-As-Dictionary", v)
+		}
+	}
+	if rule != nil && rule.CacheControl != "" {
+		h.Set("Cache-Control", rule.CacheControl)
+	} else if f.Manifest.isFingerprinted(p) {
+		h.Set("Cache-Control", ImmutableCacheControl)
+	}
+	if rule != nil {
+		for k, v := range rule.Headers {
+			h.Add(k, v)
+		}
+	}
+	if len(h) == 0 {
+		return w
+	}
+	return &responseWithHeaders{w: w, header: h}
+}
+
+func (f *FileHandler) tryServeCompressedFile(fsys http.FileSystem, fs http.Handler, ext, encoding, path string, w http.ResponseWriter, r *http.Request) bool {
+	etag, ok := fileETag(fsys, path+ext, encoding)
+	if !ok {
+		return false
+	}
 	oldPath := r.URL.Path
 	r.URL.Path = path + ext
 	crw := &connegResponseWriter{realWriter: w}
-	f.serveCompressedFile(ext, encoding, path, true, crw, r)
+	if etag != "" {
+		crw.Header().Set("Etag", etag)
+	}
+	f.serveCompressedFile(fsys, fs, ext, encoding, path, true, f.withDigests(crw, fsys, variantsDigestKey, path+ext), r)
 	r.URL.Path = oldPath
 	return !crw.Suppressed
 }
 
-func (f *fileHandler) serveCompressedFile(ext, encoding, path string, isConneg bool, w http.ResponseWriter, r *http.Request) {
-	// Set Content-Type proactively to bypass content sniffing
-	// (it'll be overridden in case of redirect or error anyway),
-	// but only set Content-Encoding on success (as it wouldn't
-	// be reset otherwise, and suppresses Content-Length; see
-	// https://golang.org/issue/1905).
-	// If we can't determine Content-Type though, then let the
-	// http.FileServer respond with its detected Content-Type
-	// (most likely application/gzip, or application/x-gzip for
-	// gzipped content).
-	if ct := mime.TypeByExtension(filepath.Ext(path)); ct != "" {
+// fileETag returns a strong ETag for the named file, specific to the given
+// coding, or an empty string if it's not a regular file.
+// It returns false if the file cannot be opened.
+func fileETag(fsys http.FileSystem, name, coding string) (string, bool) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.Mode().IsRegular() {
+		return "", true
+	}
+	return makeETag(strconv.FormatInt(fi.ModTime().UnixNano(), 36)+"-"+strconv.FormatInt(fi.Size(), 36), coding), true
+}
+
+// makeETag returns a strong ETag made of the given opaque tag, specific to
+// the given coding.
+func makeETag(tag, coding string) string {
+	if coding != "" {
+		tag += "-" + coding
+	}
+	return `"` + tag + `"`
+}
+
+// isETag returns whether the value of an If-Range header is an entity-tag,
+// as opposed to an HTTP-date.
+func isETag(s string) bool {
+	return strings.HasPrefix(s, `"`) || strings.HasPrefix(s, `W/"`)
+}
+
+func (f *FileHandler) serveCompressedFile(fsys http.FileSystem, fs http.Handler, ext, encoding, path string, isConneg bool, w http.ResponseWriter, r *http.Request) {
+	// Set Content-Type proactively to bypass content sniffing of the
+	// compressed bytes (it'll be overridden in case of redirect or error
+	// anyway), but only set Content-Encoding on success, when writing
+	// the response headers: it wouldn't be reset otherwise, and
+	// http.ServeContent doesn't send a Content-Length when a
+	// Content-Encoding has been set beforehand (as it assumes the
+	// content would then be compressed on-the-fly; see
+	// https://golang.org/issue/1905), whereas we know the exact size of
+	// the variant file.
+	// If we can't determine Content-Type from the extension, then sniff
+	// the decompressed content.
+	ct := f.typeByExtension(path)
+	if ct == "" {
+		ct = sniffContentType(fsys, path+ext, encoding)
+	}
+	if ct != "" {
 		w.Header().Set("Content-Type", ct)
-		w = &responseWithContentEncoding{w: w, encoding: encoding, isConneg: isConneg}
 	}
-	f.fs.ServeHTTP(w, r)
+	fs.ServeHTTP(&responseWithContentEncoding{w: w, encoding: encoding, isConneg: isConneg}, r)
+}
+
+// typeByExtension returns the media type associated with the extension of the
+// given path, from the Types overrides or the built-in table.
+func (f *FileHandler) typeByExtension(p string) string {
+	return typeByExtension(filepath.Ext(p), f.Types)
 }
 
 func hasToken(header, token string) bool {
@@ -190,8 +466,9 @@ func (w *connegResponseWriter) ReadFrom(src io.Reader) (int64, error) {
 
 // A responseWithContentEncoding is an http.ResponseWriter that automatically
 // adds a Content-Encoding and/or a "Vary: Accept-Encoding" response header
-// whenever WriteHeader is called with an http.StatusOK status code (or Write
-// is called without a prior call to WriteHeader).
+// whenever WriteHeader is called with an http.StatusOK or
+// http.StatusPartialContent status code (or Write is called without a prior
+// call to WriteHeader).
 type responseWithContentEncoding struct {
 	w        http.ResponseWriter
 	encoding string
@@ -209,12 +486,20 @@ func (r *responseWithContentEncoding) WriteHeader(code int) {
 		return
 	}
 	r.headersSent = true
-	if code == http.StatusOK {
+	switch code {
+	case http.StatusOK, http.StatusPartialContent:
 		if r.encoding != "" {
 			r.Header().Set("Content-Encoding", r.encoding)
 		}
+		fallthrough
+	case http.StatusNotModified:
+		// A 304 (Not Modified) must send the Vary header that a 200 would
+		// have sent (RFC 9110, Section 15.4.5.)
 		if r.isConneg {
-			r.Header().Set("Vary", "Accept-Encoding")
+			r.Header().Add("Vary", "Accept-Encoding")
+			if isDictionaryCoding(r.encoding) {
+				r.Header().Add("Vary", "Available-Dictionary")
+			}
 		}
 	}
 	r.w.WriteHeader(code)
@@ -237,6 +522,57 @@ func (r *responseWithContentEncoding) ReadFrom(src io.Reader) (n int64, err erro
 	return io.Copy(r.w, src)
 }
 
+// A responseWithHeaders is an http.ResponseWriter that automatically adds
+// headers to successful responses (2xx and http.StatusNotModified status
+// codes), and okHeader to http.StatusOK responses, when WriteHeader is called
+// (or Write is called without a prior call to WriteHeader).
+type responseWithHeaders struct {
+	w        http.ResponseWriter
+	header   http.Header
+	okHeader http.Header
+
+	headersSent bool
+}
+
+func (r *responseWithHeaders) Header() http.Header {
+	return r.w.Header()
+}
+
+func (r *responseWithHeaders) WriteHeader(code int) {
+	if r.headersSent {
+		return
+	}
+	r.headersSent = true
+	if (code >= 200 && code < 300) || code == http.StatusNotModified {
+		for k, v := range r.header {
+			r.Header()[k] = append(r.Header()[k], v...)
+		}
+	}
+	if code == http.StatusOK {
+		for k, v := range r.okHeader {
+			r.Header()[k] = append(r.Header()[k], v...)
+		}
+	}
+	r.w.WriteHeader(code)
+}
+
+func (r *responseWithHeaders) Write(b []byte) (int, error) {
+	if !r.headersSent {
+		r.WriteHeader(http.StatusOK)
+	}
+	return r.w.Write(b)
+}
+
+// ReadFrom is here to optimize copying from an *os.File regular file,
+// because we know the default http.ResponseWriter is an io.ReaderFrom
+// and http.FileServer takes advantage of it.
+func (r *responseWithHeaders) ReadFrom(src io.Reader) (n int64, err error) {
+	if !r.headersSent {
+		r.WriteHeader(http.StatusOK)
+	}
+	return io.Copy(r.w, src)
+}
+
 // GetWriter negotiates whether compression should be used and returns an
 // appropriate io.Writer. The returned writer may implement io.Closer, in which
 // case it is the caller's responsibility to Close it.
@@ -247,11 +583,29 @@ func (r *responseWithContentEncoding) ReadFrom(src io.Reader) (n int64, err erro
 //		defer c.Close()
 //	}
 // 	// ...
+//
+// If the response already has a Content-Type header, compression is only used
+// if it's compressible according to DefaultCompressible, or the function set
+// with WithCompressible.
+//
+// Compression can be disabled for a given request with DisableCompression,
+// or made to add random-length padding with PadCompression, to mitigate
+// BREACH attacks.
 func GetWriter(w http.ResponseWriter, r *http.Request) io.Writer {
 	w.Header().Add("Vary", "Accept-Encoding")
+	if compressionDisabled(r) {
+		return w
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "" && !compressibleFunc(r)(ct) {
+		return w
+	}
 	if hasToken(r.Header.Get("Accept-Encoding"), "gzip") {
 		w.Header().Set("Content-Encoding", "gzip")
-		return gzip.NewWriter(w)
+		gw := gzip.NewWriter(w)
+		if max := compressionPadding(r); max > 0 {
+			gw.Header.Extra = randomPadding(max)
+		}
+		return gw
 	}
 	return w
 }
@@ -7,12 +7,15 @@ package encneg
 import (
 	"compress/gzip"
 	"io"
-	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"reflect"
 	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"golang.org/x/tools/godoc/vfs/httpfs"
 	"golang.org/x/tools/godoc/vfs/mapfs"
@@ -234,7 +237,7 @@ func TestGetWriter(t *testing.T) {
 			}
 			if r, err := gzip.NewReader(rec.Body); err != nil {
 				t.Errorf("test %s: %v", ae.ae, err)
-			} else if buf, err := ioutil.ReadAll(r); err != nil {
+			} else if buf, err := io.ReadAll(r); err != nil {
 				t.Errorf("test %s: %v", ae.ae, err)
 			} else if g, e := string(buf), "Hello World!"; g != e {
 				t.Errorf("test %s: body = %q, want %q", ae.ae, g, e)
@@ -252,3 +255,279 @@ func TestGetWriter(t *testing.T) {
 		}
 	}
 }
+
+func TestFileServerVariantsOverlay(t *testing.T) {
+	root := httpfs.New(mapfs.New(map[string]string{
+		"css/site.css":     "site, uncompressed",
+		"css/other.css":    "other, uncompressed",
+		"css/other.css.gz": "other, gzip, in root",
+	}))
+	variants := httpfs.New(mapfs.New(map[string]string{
+		"css/site.css.br": "site, brotli, in variants",
+		"css/site.css.gz": "site, gzip, in variants",
+	}))
+	fs := &FileHandler{Root: root, Variants: variants}
+
+	testData := []struct {
+		path                string
+		acceptEncoding      string
+		wantCode            int
+		wantContentEncoding string
+		wantBody            string
+	}{
+		{"/css/site.css", "", http.StatusOK, "", "site, uncompressed"},
+		{"/css/site.css", "br", http.StatusOK, "br", "site, brotli, in variants"},
+		{"/css/site.css", "gzip", http.StatusOK, "gzip", "site, gzip, in variants"},
+		{"/css/site.css.br", "", http.StatusOK, "br", "site, brotli, in variants"},
+		// Variants are only looked up in the Variants file system
+		{"/css/other.css", "gzip", http.StatusOK, "", "other, uncompressed"},
+		// but files in Root can still be requested directly
+		{"/css/other.css.gz", "", http.StatusOK, "gzip", "other, gzip, in root"},
+		{"/css/missing.css.gz", "", http.StatusNotFound, "", "404 page not found\n"},
+	}
+	for _, tt := range testData {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Body.String(), tt.wantBody; g != e {
+			t.Errorf("test %s: body = %q, want %q", test, g, e)
+		}
+	}
+}
+
+func TestFileServerRanges(t *testing.T) {
+	const path = "/with.br.and.gz/foo.html"
+	identity := &FileHandler{Root: fs.(*FileHandler).Root, RangePolicy: RangeIdentity}
+
+	etags := make(map[string]string)
+	for _, ae := range []string{"", "br", "gzip"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", ae)
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+		etags[ae] = rec.Header().Get("Etag")
+		if etags[ae] == "" {
+			t.Fatalf("test [%s]: missing etag", ae)
+		}
+	}
+	if etags[""] == etags["br"] || etags[""] == etags["gzip"] || etags["br"] == etags["gzip"] {
+		t.Fatalf("etags are not specific to variants: %v", etags)
+	}
+	for _, ae := range []string{"", "br"} {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Encoding", ae)
+		req.Header.Set("If-None-Match", etags[ae])
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+		if g, e := rec.Code, http.StatusNotModified; g != e {
+			t.Errorf("test [%s]: status = %d, want %d", ae, g, e)
+		}
+		if g, e := rec.Header().Get("Vary"), "Accept-Encoding"; g != e {
+			t.Errorf("test [%s]: vary = %q, want %q", ae, g, e)
+		}
+	}
+
+	testData := []struct {
+		handler             http.Handler
+		acceptEncoding      string
+		ifRange             string
+		wantCode            int
+		wantContentEncoding string
+		wantBody            string
+	}{
+		{fs, "", "", http.StatusPartialContent, "", "foo"},
+		{fs, "br", "", http.StatusPartialContent, "br", "foo"},
+		{fs, "gzip", "", http.StatusPartialContent, "gzip", "foo"},
+		{fs, "br", etags["br"], http.StatusPartialContent, "br", "foo"},
+		{fs, "br", etags["gzip"], http.StatusOK, "br", fsmap["with.br.and.gz/foo.html.br"]},
+		{fs, "gzip", etags["br"], http.StatusOK, "gzip", fsmap["with.br.and.gz/foo.html.gz"]},
+		{fs, "", etags["br"], http.StatusOK, "", fsmap["with.br.and.gz/foo.html"]},
+		{fs, "br", "Wed, 02 Nov 2016 10:00:00 GMT", http.StatusOK, "br", fsmap["with.br.and.gz/foo.html.br"]},
+		{identity, "br", "", http.StatusPartialContent, "", "foo"},
+		{identity, "br", etags[""], http.StatusPartialContent, "", "foo"},
+		{identity, "br", etags["br"], http.StatusOK, "", fsmap["with.br.and.gz/foo.html"]},
+	}
+	for _, tt := range testData {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Range", "bytes=0-2")
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		if tt.ifRange != "" {
+			req.Header.Set("If-Range", tt.ifRange)
+		}
+		rec := httptest.NewRecorder()
+		tt.handler.ServeHTTP(rec, req)
+
+		test := "[" + tt.acceptEncoding + "][" + tt.ifRange + "]"
+		if tt.handler == identity {
+			test = "identity" + test
+		}
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Etag"), etags[tt.wantContentEncoding]; g != e {
+			t.Errorf("test %s: etag = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Body.String(), tt.wantBody; g != e {
+			t.Errorf("test %s: body = %q, want %q", test, g, e)
+		}
+	}
+}
+
+func TestFileServerDateIfRange(t *testing.T) {
+	modtime := time.Date(2016, time.November, 2, 10, 0, 0, 0, time.UTC)
+	fsys := fstest.MapFS{
+		"plain.txt":     {Data: []byte("foobar"), ModTime: modtime},
+		"foo.txt":       {Data: []byte("foobar"), ModTime: modtime},
+		"foo.txt.gz":    {Data: []byte("gzipped"), ModTime: modtime},
+		"bronly.txt":    {Data: []byte("foobar"), ModTime: modtime},
+		"bronly.txt.br": {Data: []byte("brotli"), ModTime: modtime},
+	}
+	h := FileServer(http.FS(fsys))
+
+	testData := []struct {
+		path           string
+		acceptEncoding string
+		wantCode       int
+		wantBody       string
+	}{
+		{"/plain.txt", "gzip", http.StatusPartialContent, "foo"},
+		{"/foo.txt", "gzip", http.StatusOK, "gzipped"},
+		{"/foo.txt", "", http.StatusPartialContent, "foo"},
+		{"/bronly.txt", "gzip", http.StatusPartialContent, "foo"},
+	}
+	for _, tt := range testData {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Range", "bytes=0-2")
+		req.Header.Set("If-Range", modtime.Format(http.TimeFormat))
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Body.String(), tt.wantBody; g != e {
+			t.Errorf("test %s: body = %q, want %q", test, g, e)
+		}
+	}
+}
+
+func TestFileServerMultipartRanges(t *testing.T) {
+	for _, tt := range aes[:3] {
+		ae := tt.ae
+		_, ext := expectedEncoding("with.br.and.gz", tt)
+		content := fsmap["with.br.and.gz/foo.html"+ext]
+
+		req := httptest.NewRequest("GET", "/with.br.and.gz/foo.html", nil)
+		req.Header.Set("Range", "bytes=0-2,5-9")
+		if ae != "" {
+			req.Header.Set("Accept-Encoding", ae)
+		}
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+
+		if g, e := rec.Code, http.StatusPartialContent; g != e {
+			t.Errorf("test [%s]: status = %d, want %d", ae, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), ae; g != e {
+			t.Errorf("test [%s]: content-encoding = %q, want %q", ae, g, e)
+		}
+		mediaType, params, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Errorf("test [%s]: content-type = %q, want multipart/byteranges", ae, rec.Header().Get("Content-Type"))
+			continue
+		}
+		mr := multipart.NewReader(rec.Body, params["boundary"])
+		for _, want := range []string{content[0:3], content[5:10]} {
+			part, err := mr.NextPart()
+			if err != nil {
+				t.Errorf("test [%s]: %v", ae, err)
+				break
+			}
+			if g, e := part.Header.Get("Content-Type"), "text/html; charset=utf-8"; g != e {
+				t.Errorf("test [%s]: part content-type = %q, want %q", ae, g, e)
+			}
+			if body, err := io.ReadAll(part); err != nil {
+				t.Errorf("test [%s]: %v", ae, err)
+			} else if g, e := string(body), want; g != e {
+				t.Errorf("test [%s]: part body = %q, want %q", ae, g, e)
+			}
+		}
+		if _, err := mr.NextPart(); err != io.EOF {
+			t.Errorf("test [%s]: got more parts than expected", ae)
+		}
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	zr := newZipReader(t)
+	var zipLen int
+	for _, f := range zr.File {
+		if f.Name == "docs/foo.txt" {
+			// gzip header and trailer around the raw deflate stream
+			zipLen = 10 + int(f.CompressedSize64) + 8
+		}
+	}
+	gzipped := encode(t, "gzip", []byte(zipContents["docs/foo.txt"]))
+	variants := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ServeVariants(w, r, "foo.txt", modtime, map[string]io.ReadSeeker{
+			"":     strings.NewReader(zipContents["docs/foo.txt"]),
+			"gzip": strings.NewReader(string(gzipped)),
+		})
+	})
+	for _, tt := range []struct {
+		name    string
+		h       http.Handler
+		path    string
+		wantLen int
+	}{
+		{"fileserver", fs, "/with.gz/foo.html", len(fsmap["with.gz/foo.html.gz"])},
+		{"fileserver", fs, "/with.gz/foo.html.gz", len(fsmap["with.gz/foo.html.gz"])},
+		{"fileserver", fs, "/with.br/foo.html", len(fsmap["with.br/foo.html"])},
+		{"variants", variants, "/foo.txt", len(gzipped)},
+		{"zip", ZipFileServer(zr), "/docs/foo.txt", zipLen},
+	} {
+		s := httptest.NewServer(tt.h)
+		for _, method := range []string{"GET", "HEAD"} {
+			req, _ := http.NewRequest(method, s.URL+tt.path, nil)
+			req.Header.Set("Accept-Encoding", "gzip")
+			res, err := s.Client().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			res.Body.Close()
+
+			test := tt.name + " " + method + " " + tt.path
+			if g, e := res.ContentLength, int64(tt.wantLen); g != e {
+				t.Errorf("test %s: content-length = %d, want %d", test, g, e)
+			}
+			if method == "GET" && len(body) != tt.wantLen {
+				t.Errorf("test %s: body length = %d, want %d", test, len(body), tt.wantLen)
+			}
+			if len(res.TransferEncoding) != 0 {
+				t.Errorf("test %s: transfer-encoding = %v, want none", test, res.TransferEncoding)
+			}
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+)
+
+// ImmutableCacheControl is the Cache-Control response header value sent by
+// FileHandler for fingerprinted files listed in its Manifest.
+const ImmutableCacheControl = "public, max-age=31536000, immutable"
+
+// A Manifest maps logical asset names to fingerprinted file names, as
+// produced by build tools (such as app.js to app.3f9a1c.js.)
+//
+// Fingerprinted files, and their precompressed variants, are served by
+// a FileHandler like any other file, but with a long-lived immutable caching.
+type Manifest struct {
+	// Prefix is the URL path prefix under which the FileHandler serving the
+	// assets is mounted, used by AssetURL. If empty, it defaults to "/".
+	Prefix string
+
+	assets        map[string]string
+	fingerprinted map[string]bool
+}
+
+// LoadManifest reads a JSON object mapping logical asset names to
+// fingerprinted file names, both being slash-separated paths relative to
+// the root of the FileHandler's file system:
+//
+//	{
+//		"app.js": "app.3f9a1c.js",
+//		"css/site.css": "css/site.81ac2e.css"
+//	}
+func LoadManifest(r io.Reader) (*Manifest, error) {
+	var assets map[string]string
+	if err := json.NewDecoder(r).Decode(&assets); err != nil {
+		return nil, err
+	}
+	m := &Manifest{
+		assets:        make(map[string]string, len(assets)),
+		fingerprinted: make(map[string]bool, len(assets)),
+	}
+	for name, file := range assets {
+		name, file = strings.TrimPrefix(name, "/"), strings.TrimPrefix(file, "/")
+		if name == "" || file == "" {
+			return nil, errors.New("encneg: empty asset name in manifest")
+		}
+		m.assets[name] = file
+		m.fingerprinted[file] = true
+	}
+	return m, nil
+}
+
+// AssetURL returns the URL path of the fingerprinted file for the given
+// logical asset name, or an error if the asset is not in the manifest.
+//
+// It is meant to be used as a template function:
+//
+//	t := template.New("page").Funcs(template.FuncMap{"asset": manifest.AssetURL})
+//
+//	<script src="{{asset "app.js"}}"></script>
+func (m *Manifest) AssetURL(name string) (string, error) {
+	file, ok := m.lookup(name)
+	if !ok {
+		return "", errors.New("encneg: unknown asset " + name)
+	}
+	prefix := m.Prefix
+	if prefix == "" {
+		prefix = "/"
+	} else if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return prefix + file, nil
+}
+
+// lookup returns the file of the asset with the given logical name, with or
+// without a leading slash.
+func (m *Manifest) lookup(name string) (string, bool) {
+	if m == nil {
+		return "", false
+	}
+	file, ok := m.assets[strings.TrimPrefix(name, "/")]
+	return file, ok
+}
+
+// isFingerprinted returns whether the file at the given path (relative to
+// the root of the FileHandler's file system) is a fingerprinted file.
+func (m *Manifest) isFingerprinted(p string) bool {
+	return m != nil && m.fingerprinted[strings.TrimPrefix(p, "/")]
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+const manifestJSON = `{
+	"app.js": "app.3f9a1c.js",
+	"/css/site.css": "/css/site.81ac2e.css"
+}`
+
+func TestManifestAssetURL(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(manifestJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		prefix, name, want string
+	}{
+		{"", "app.js", "/app.3f9a1c.js"},
+		{"", "/app.js", "/app.3f9a1c.js"},
+		{"", "css/site.css", "/css/site.81ac2e.css"},
+		{"/static", "app.js", "/static/app.3f9a1c.js"},
+		{"/static/", "css/site.css", "/static/css/site.81ac2e.css"},
+	} {
+		m.Prefix = tt.prefix
+		if g, err := m.AssetURL(tt.name); err != nil {
+			t.Errorf("test %s%s: %v", tt.prefix, tt.name, err)
+		} else if e := tt.want; g != e {
+			t.Errorf("test %s%s: url = %q, want %q", tt.prefix, tt.name, g, e)
+		}
+	}
+	if _, err := m.AssetURL("missing.js"); err == nil {
+		t.Errorf("test missing.js: expected error")
+	}
+
+	m.Prefix = ""
+	tmpl := template.Must(template.New("page").Funcs(template.FuncMap{"asset": m.AssetURL}).Parse(`<script src="{{asset "app.js"}}"></script>`))
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, nil); err != nil {
+		t.Error(err)
+	} else if g, e := buf.String(), `<script src="/app.3f9a1c.js"></script>`; g != e {
+		t.Errorf("template = %q, want %q", g, e)
+	}
+}
+
+func TestFileServerManifest(t *testing.T) {
+	m, err := LoadManifest(strings.NewReader(manifestJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &FileHandler{
+		Root: httpfs.New(mapfs.New(map[string]string{
+			"app.js":              "app, not fingerprinted",
+			"app.3f9a1c.js":       "app, fingerprinted",
+			"app.3f9a1c.js.br":    "app, fingerprinted, brotli",
+			"css/site.81ac2e.css": "site, fingerprinted",
+		})),
+		Manifest: m,
+		Rules:    []Rule{{Pattern: "/css/", CacheControl: "no-cache"}},
+	}
+
+	for _, tt := range []struct {
+		path                string
+		acceptEncoding      string
+		wantContentEncoding string
+		wantCacheControl    string
+	}{
+		{"/app.js", "br", "", ""},
+		{"/app.3f9a1c.js", "", "", ImmutableCacheControl},
+		{"/app.3f9a1c.js", "br", "br", ImmutableCacheControl},
+		{"/app.3f9a1c.js.br", "", "br", ImmutableCacheControl},
+		{"/css/site.81ac2e.css", "", "", "no-cache"},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, http.StatusOK; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Cache-Control"), tt.wantCacheControl; g != e {
+			t.Errorf("test %s: cache-control = %q, want %q", test, g, e)
+		}
+	}
+}
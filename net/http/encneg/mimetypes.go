@@ -0,0 +1,117 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// TypesVersion identifies the revision of the built-in table mapping file
+// extensions to media types (see FileHandler.Types). It changes whenever
+// the table does, so that deployments can tell whether the Content-Type of
+// their files might have changed.
+const TypesVersion = "2026-10-18"
+
+// builtinTypes maps file extensions to media types. Unlike
+// mime.TypeByExtension, it doesn't depend on the host's mime.types files,
+// so files are served with the same Content-Type whatever the system.
+// Update TypesVersion when changing it.
+//
+// Types of textual formats include a UTF-8 charset, like the ones built into
+// the mime package.
+var builtinTypes = map[string]string{
+	".apng":        "image/apng",
+	".avif":        "image/avif",
+	".bmp":         "image/bmp",
+	".css":         "text/css; charset=utf-8",
+	".csv":         "text/csv; charset=utf-8",
+	".gif":         "image/gif",
+	".htm":         "text/html; charset=utf-8",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/vnd.microsoft.icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".jsonld":      "application/ld+json",
+	".map":         "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".mp3":         "audio/mpeg",
+	".mp4":         "video/mp4",
+	".oga":         "audio/ogg",
+	".ogg":         "audio/ogg",
+	".ogv":         "video/ogg",
+	".otf":         "font/otf",
+	".pdf":         "application/pdf",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".ttf":         "font/ttf",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".wav":         "audio/wav",
+	".webm":        "video/webm",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".woff":        "font/woff",
+	".woff2":       "font/woff2",
+	".xhtml":       "application/xhtml+xml",
+	".xml":         "text/xml; charset=utf-8",
+}
+
+// typeByExtension returns the media type associated with the file extension
+// ext (including the leading dot), looking it up in the given overrides
+// first, then in the built-in table. Extensions are case-insensitive.
+func typeByExtension(ext string, overrides map[string]string) string {
+	if ext == "" {
+		return ""
+	}
+	if ct, ok := overrides[ext]; ok {
+		return ct
+	}
+	lower := strings.ToLower(ext)
+	if ct, ok := overrides[lower]; ok {
+		return ct
+	}
+	return builtinTypes[lower]
+}
+
+// sniffContentType determines the Content-Type of the named file by sniffing
+// its first 512 bytes, once decoded with the given coding. If the file cannot
+// be decoded (such as when the coding isn't registered), it returns
+// "application/octet-stream". If the file doesn't exist or isn't a regular
+// file, it returns the empty string.
+func sniffContentType(fsys http.FileSystem, name, coding string) string {
+	const fallback = "application/octet-stream"
+	f, err := fsys.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	if fi, err := f.Stat(); err != nil || !fi.Mode().IsRegular() {
+		return ""
+	}
+	var r io.Reader = f
+	if coding != "" {
+		c, ok := lookupCoding(coding)
+		if !ok {
+			return fallback
+		}
+		rc, err := c.NewReader(f)
+		if err != nil {
+			return fallback
+		}
+		defer rc.Close()
+		r = rc
+	}
+	var buf [512]byte
+	n, err := io.ReadFull(r, buf[:])
+	if n == 0 || (err != nil && err != io.EOF && err != io.ErrUnexpectedEOF) {
+		return fallback
+	}
+	return http.DetectContentType(buf[:n])
+}
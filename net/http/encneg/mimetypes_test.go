@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/tools/godoc/vfs/httpfs"
+	"golang.org/x/tools/godoc/vfs/mapfs"
+)
+
+func TestTypeByExtension(t *testing.T) {
+	overrides := map[string]string{".js": "application/javascript", ".foo": "application/x-foo"}
+	for _, tt := range []struct {
+		ext       string
+		overrides map[string]string
+		want      string
+	}{
+		{".html", nil, "text/html; charset=utf-8"},
+		{".HTML", nil, "text/html; charset=utf-8"},
+		{".js", nil, "text/javascript; charset=utf-8"},
+		{".js", overrides, "application/javascript"},
+		{".JS", overrides, "application/javascript"},
+		{".foo", overrides, "application/x-foo"},
+		{".foo", nil, ""},
+		{"", nil, ""},
+	} {
+		if g, e := typeByExtension(tt.ext, tt.overrides), tt.want; g != e {
+			t.Errorf("test %s: type = %q, want %q", tt.ext, g, e)
+		}
+	}
+}
+
+func TestFileServerContentType(t *testing.T) {
+	html := "<!DOCTYPE html><title>unknown</title>"
+	files := map[string]string{
+		"page.unknown":    html,
+		"page.unknown.gz": string(encode(t, "gzip", []byte(html))),
+		"data.unknown.br": "not really brotli",
+		"app.foo":         "foo",
+		"app.foo.gz":      string(encode(t, "gzip", []byte("foo"))),
+		// Not in the built-in table, but known to the mime package (and
+		// most hosts' mime.types files) as application/msword
+		"report.doc":    "%PDF-1.4",
+		"report.doc.gz": string(encode(t, "gzip", []byte("%PDF-1.4"))),
+	}
+	h := &FileHandler{
+		Root:  httpfs.New(mapfs.New(files)),
+		Types: map[string]string{".foo": "application/x-foo"},
+	}
+	for _, tt := range []struct {
+		path, acceptEncoding string
+		wantContentType      string
+		wantContentEncoding  string
+	}{
+		{"/page.unknown", "", "text/html; charset=utf-8", ""},
+		// Sniffed from the decompressed content
+		{"/page.unknown", "gzip", "text/html; charset=utf-8", "gzip"},
+		{"/page.unknown.gz", "", "text/html; charset=utf-8", "gzip"},
+		// Brotli isn't registered, so the content cannot be sniffed
+		{"/data.unknown.br", "", "application/octet-stream", "br"},
+		{"/app.foo", "", "application/x-foo", ""},
+		{"/app.foo", "gzip", "application/x-foo", "gzip"},
+		// The mime package is never used, the content is sniffed
+		{"/report.doc", "", "application/pdf", ""},
+		{"/report.doc", "gzip", "application/pdf", "gzip"},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, http.StatusOK; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Type"), tt.wantContentType; g != e {
+			t.Errorf("test %s: content-type = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+	}
+}
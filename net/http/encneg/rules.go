@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"path"
+	"strings"
+)
+
+// A Rule configures how a FileHandler serves the files whose path matches
+// its Pattern.
+//
+// Rules can be loaded from a JSON file with LoadRules.
+type Rule struct {
+	// Pattern is matched against the path of the requested file.
+	// A pattern ending with a slash matches all paths with that prefix;
+	// other patterns use the syntax of path.Match (where * doesn't match
+	// slashes), such as "/assets/*.js".
+	Pattern string `json:"pattern"`
+
+	// Codings lists the content codings allowed for the matching files.
+	// If nil, all codings are allowed; if empty, only the identity is.
+	Codings []string `json:"codings"`
+
+	// CacheControl, if non-empty, is sent as the Cache-Control response
+	// header, such as "public, max-age=31536000, immutable".
+	CacheControl string `json:"cacheControl,omitempty"`
+
+	// Headers are added to the responses.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// DenyVariants denies direct access to the precompressed variants of
+	// the matching files (such as /foo.js.br for /foo.js.)
+	DenyVariants bool `json:"denyVariants,omitempty"`
+}
+
+// LoadRules reads a JSON array of rules. Rule patterns are checked for
+// syntax errors.
+//
+// For example:
+//
+//	[
+//		{"pattern": "/assets/", "cacheControl": "public, max-age=31536000, immutable"},
+//		{"pattern": "/*.html", "codings": ["br"], "headers": {"X-Frame-Options": "DENY"}},
+//		{"pattern": "/downloads/", "codings": [], "denyVariants": true}
+//	]
+func LoadRules(r io.Reader) ([]Rule, error) {
+	var rules []Rule
+	if err := json.NewDecoder(r).Decode(&rules); err != nil {
+		return nil, err
+	}
+	for _, rule := range rules {
+		if rule.Pattern == "" {
+			return nil, errors.New("encneg: rule with empty pattern")
+		}
+		if _, err := path.Match(rule.Pattern, ""); err != nil {
+			return nil, errors.New("encneg: invalid rule pattern " + rule.Pattern + ": " + err.Error())
+		}
+	}
+	return rules, nil
+}
+
+func (rule *Rule) matches(p string) bool {
+	if strings.HasSuffix(rule.Pattern, "/") {
+		return strings.HasPrefix(p, rule.Pattern)
+	}
+	matched, _ := path.Match(rule.Pattern, p)
+	return matched
+}
+
+// allows returns whether the coding is allowed by the rule, that can be nil.
+func (rule *Rule) allows(coding string) bool {
+	return rule == nil || rule.Codings == nil || contains(rule.Codings, coding)
+}
+
+// matchRule returns the first rule matching the path, or nil.
+func matchRule(rules []Rule, p string) *Rule {
+	for i := range rules {
+		if rules[i].matches(p) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const rulesJSON = `[
+	{"pattern": "/with.br.and.gz/", "codings": ["gzip"], "cacheControl": "no-cache", "headers": {"X-Foo": "bar"}},
+	{"pattern": "/with.br/*.html", "denyVariants": true},
+	{"pattern": "/with.gz/", "codings": []}
+]`
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(rulesJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, e := len(rules), 3; g != e {
+		t.Fatalf("len(rules) = %d, want %d", g, e)
+	}
+	if rules[1].Codings != nil {
+		t.Errorf("rules[1].codings = %v, want nil", rules[1].Codings)
+	}
+	if rules[2].Codings == nil || len(rules[2].Codings) != 0 {
+		t.Errorf("rules[2].codings = %#v, want empty", rules[2].Codings)
+	}
+
+	for _, invalid := range []string{
+		`[{"pattern": "/foo/[", "codings": []}]`,
+		`[{"codings": []}]`,
+		`{"pattern": "/"}`,
+	} {
+		if _, err := LoadRules(strings.NewReader(invalid)); err == nil {
+			t.Errorf("test %s: expected error", invalid)
+		}
+	}
+}
+
+func TestFileServerRules(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(rulesJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fs := &FileHandler{Root: fs.(*FileHandler).Root, Rules: rules}
+
+	testData := []struct {
+		path                string
+		acceptEncoding      string
+		wantCode            int
+		wantContentEncoding string
+		wantCacheControl    string
+		wantFoo             string
+	}{
+		{"/with.br.and.gz/foo.html", "br, gzip", http.StatusOK, "gzip", "no-cache", "bar"},
+		{"/with.br.and.gz/", "br", http.StatusOK, "", "no-cache", "bar"},
+		{"/with.br.and.gz/foo.html.br", "", http.StatusOK, "br", "no-cache", "bar"},
+		{"/with.br.and.gz/missing.html", "", http.StatusNotFound, "", "", ""},
+		{"/with.br/foo.html", "br", http.StatusOK, "br", "", ""},
+		{"/with.br/foo.html.br", "br", http.StatusNotFound, "", "", ""},
+		{"/with.gz/foo.html", "gzip", http.StatusOK, "", "", ""},
+		{"/with.gz/foo.html.gz", "", http.StatusOK, "gzip", "", ""},
+	}
+	for _, tt := range testData {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		fs.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Cache-Control"), tt.wantCacheControl; g != e {
+			t.Errorf("test %s: cache-control = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("X-Foo"), tt.wantFoo; g != e {
+			t.Errorf("test %s: x-foo = %q, want %q", test, g, e)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultMaxRatio is the maximum decompression ratio used by Transport when
+// its MaxRatio is zero.
+const DefaultMaxRatio = 100
+
+// Transport is an http.RoundTripper that negotiates content codings with the
+// server and transparently decodes responses.
+//
+// Unlike the standard http.Transport, which only handles gzip, Transport
+// advertises all the configured codings in the Accept-Encoding request header.
+// Decoded responses have their Content-Encoding and Content-Length headers
+// removed, and their Uncompressed field set to true; responses without
+// a body (such as a 304, or an empty 200 with a Content-Length of zero) are
+// returned untouched. Decoding only starts when the body is first read, so
+// RoundTrip returns as soon as the response headers are received.
+//
+// Out of the box, only gzip and deflate are supported; importing the
+// go.ltgt.net/net/http/encneg/br and go.ltgt.net/net/http/encneg/zstd packages
+// adds support for br and zstd. They're separate packages so that programs
+// only depend on a Brotli or Zstandard implementation if they use it.
+//
+// As with http.Transport, if the request already has an Accept-Encoding or a
+// Range header, the request is sent as-is and the response returned untouched.
+type Transport struct {
+	// Base is the underlying http.RoundTripper.
+	// If nil, http.DefaultTransport is used.
+	Base http.RoundTripper
+
+	// Codings lists the codings to advertise, in order of preference;
+	// codings that haven't been registered are ignored.
+	// If nil, all the registered codings are used (see RegisterCoding.)
+	Codings []string
+
+	// MaxRatio is the maximum allowed ratio of decoded to encoded bytes.
+	// Reading a response body exceeding that ratio fails with
+	// ErrRatioExceeded.
+	// If zero, DefaultMaxRatio is used; if negative, there's no limit.
+	MaxRatio int
+}
+
+// RoundTrip implements the http.RoundTripper interface.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return base.RoundTrip(req)
+	}
+	cs := registeredCodings()
+	if t.Codings != nil {
+		cs = supportedCodings(t.Codings)
+	}
+	if len(cs) == 0 {
+		return base.RoundTrip(req)
+	}
+
+	// The RoundTripper contract forbids modifying the request.
+	r2 := cloneRequest(req)
+	r2.Header.Set("Accept-Encoding", strings.Join(cs, ", "))
+
+	resp, err := base.RoundTrip(r2)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method == "HEAD" || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified || resp.ContentLength == 0 {
+		return resp, nil
+	}
+	applied := parseCodings(resp.Header.Get("Content-Encoding"))
+	if len(applied) == 0 {
+		return resp, nil
+	}
+	for _, c := range applied {
+		if !contains(cs, c) {
+			// Leave the response untouched, the caller will have to deal
+			// with the unexpected coding.
+			return resp, nil
+		}
+	}
+	maxRatio := t.MaxRatio
+	if maxRatio == 0 {
+		maxRatio = DefaultMaxRatio
+	} else if maxRatio < 0 {
+		maxRatio = 0
+	}
+	body, err := newDecoder(resp.Body, applied, lookupCoding, 0, maxRatio)
+	if err != nil {
+		// newDecoder closed resp.Body
+		return nil, err
+	}
+	resp.Body = body
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// cloneRequest returns a shallow copy of r, with a copy of its headers.
+func cloneRequest(r *http.Request) *http.Request {
+	r2 := new(http.Request)
+	*r2 = *r
+	r2.Header = make(http.Header, len(r.Header)+1)
+	for k, v := range r.Header {
+		r2.Header[k] = v
+	}
+	return r2
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
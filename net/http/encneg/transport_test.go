@@ -0,0 +1,238 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func encode(t *testing.T, coding string, content []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch coding {
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		t.Fatalf("unexpected coding %q", coding)
+	}
+	w.Write(content)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestSortCodings(t *testing.T) {
+	names := []string{"x-foo", "gzip", "deflate", "zstd", "br", "compress"}
+	sortCodings(names)
+	if g, e := names, []string{"br", "zstd", "gzip", "deflate", "compress", "x-foo"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("sortCodings = %v, want %v", g, e)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	const content = "Hello World!"
+	var gotAE string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAE = r.Header.Get("Accept-Encoding")
+		coding := r.URL.Query().Get("coding")
+		body := []byte(content)
+		switch coding {
+		case "":
+		case "gzip, deflate":
+			body = encode(t, "deflate", encode(t, "gzip", body))
+		case "gzip", "deflate":
+			body = encode(t, coding, body)
+		default:
+			// unknown coding; send as-is
+		}
+		if coding != "" {
+			w.Header().Set("Content-Encoding", coding)
+		}
+		w.Write(body)
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{Codings: []string{"gzip", "deflate"}}}
+	for _, coding := range []string{"", "gzip", "deflate", "gzip, deflate"} {
+		resp, err := client.Get(srv.URL + "/?coding=" + url.QueryEscape(coding))
+		if err != nil {
+			t.Fatalf("test %q: %v", coding, err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("test %q: %v", coding, err)
+		}
+		if g, e := gotAE, "gzip, deflate"; g != e {
+			t.Errorf("test %q: accept-encoding = %q, want %q", coding, g, e)
+		}
+		if g, e := string(body), content; g != e {
+			t.Errorf("test %q: body = %q, want %q", coding, g, e)
+		}
+		if g := resp.Header.Get("Content-Encoding"); g != "" {
+			t.Errorf("test %q: content-encoding = %q, want none", coding, g)
+		}
+		if g, e := resp.Uncompressed, coding != ""; g != e {
+			t.Errorf("test %q: uncompressed = %t, want %t", coding, g, e)
+		}
+		if coding != "" && resp.ContentLength != -1 {
+			t.Errorf("test %q: content-length = %d, want -1", coding, resp.ContentLength)
+		}
+	}
+
+	// Unknown codings are left untouched
+	resp, err := client.Get(srv.URL + "/?coding=x-unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if g, e := resp.Header.Get("Content-Encoding"), "x-unknown"; g != e {
+		t.Errorf("test x-unknown: content-encoding = %q, want %q", g, e)
+	}
+
+	// Caller-provided Accept-Encoding disables negotiation
+	req, _ := http.NewRequest("GET", srv.URL+"/?coding=gzip", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if g, e := resp.Header.Get("Content-Encoding"), "gzip"; g != e {
+		t.Errorf("test caller accept-encoding: content-encoding = %q, want %q", g, e)
+	}
+	if g, e := req.Header.Get("Accept-Encoding"), "gzip"; g != e {
+		t.Errorf("test caller accept-encoding: request was modified; accept-encoding = %q, want %q", g, e)
+	}
+}
+
+func TestTransportEmptyBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		switch r.URL.Path {
+		case "/redirect":
+			w.Header().Set("Location", "/empty")
+			w.WriteHeader(http.StatusFound)
+		case "/chunked":
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &Transport{}}
+	for _, path := range []string{"/redirect", "/empty", "/chunked"} {
+		resp, err := client.Get(srv.URL + path)
+		if err != nil {
+			t.Errorf("test %s: %v", path, err)
+			continue
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Errorf("test %s: %v", path, err)
+		}
+		if len(body) != 0 {
+			t.Errorf("test %s: body = %q, want empty", path, body)
+		}
+	}
+}
+
+func TestTransportStreaming(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write(encode(t, "gzip", []byte("Hello World!")))
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	// RoundTrip must return with the headers, before the body is sent.
+	resp, err := (&http.Client{Transport: &Transport{}, Timeout: 5 * time.Second}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	release <- struct{}{}
+	if body, err := io.ReadAll(resp.Body); err != nil {
+		t.Error(err)
+	} else if g, e := string(body), "Hello World!"; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
+
+func TestTransportRegisteredCodings(t *testing.T) {
+	RegisterCoding("x-test", Coding{
+		NewReader: func(r io.Reader) (io.ReadCloser, error) { return io.NopCloser(r), nil },
+	})
+	defer func() {
+		codingsMu.Lock()
+		delete(codings, "x-test")
+		codingsMu.Unlock()
+	}()
+
+	var gotAE string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAE = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "x-test")
+		io.WriteString(w, "Hello World!")
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: &Transport{}}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if g, e := gotAE, "gzip, deflate, x-test"; g != e {
+		t.Errorf("accept-encoding = %q, want %q", g, e)
+	}
+	if !resp.Uncompressed {
+		t.Errorf("response was not decoded")
+	}
+}
+
+func TestTransportMaxRatio(t *testing.T) {
+	bomb := encode(t, "gzip", make([]byte, 10<<20))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(bomb)
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		maxRatio int
+		wantErr  error
+	}{
+		{0, ErrRatioExceeded},
+		{100000, nil},
+		{-1, nil},
+	} {
+		resp, err := (&http.Client{Transport: &Transport{MaxRatio: tt.maxRatio}}).Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n, err := io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		if err != tt.wantErr {
+			t.Errorf("test %d: err = %v, want %v", tt.maxRatio, err, tt.wantErr)
+		}
+		if tt.wantErr == nil && n != 10<<20 {
+			t.Errorf("test %d: read %d bytes, want %d", tt.maxRatio, n, 10<<20)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ServeVariants replies to the request using the content in the provided
+// variants, negotiating the content coding based on the request's
+// Accept-Encoding.
+//
+// The variants map is keyed by content coding, with the empty string being
+// the identity (uncompressed) variant. When several variants are acceptable,
+// Brotli is preferred, then Zstandard, Gzip and Deflate.
+// If no variant is acceptable, ServeVariants replies with a
+// 406 (Not Acceptable) status code.
+//
+// Once a variant has been chosen, ServeVariants behaves like http.ServeContent
+// (handling Range and conditional requests), except that the Content-Type
+// is determined from the name's extension or by sniffing the identity
+// variant (never the encoded bytes), and a "Vary: Accept-Encoding" response
+// header is added when there are encoded variants.
+//
+// If the response already has an ETag header, it's made specific to the
+// chosen variant by appending the coding to the opaque tag. Range requests
+// with a date-based If-Range are served the full representation, as the date
+// cannot tell variants apart.
+func ServeVariants(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, variants map[string]io.ReadSeeker) {
+	coding, ok := negotiateVariant(r.Header.Get("Accept-Encoding"), variants)
+	_, hasIdentity := variants[""]
+	isConneg := len(variants) > 1 || (len(variants) == 1 && !hasIdentity)
+	if !ok {
+		if isConneg {
+			w.Header().Add("Vary", "Accept-Encoding")
+		}
+		http.Error(w, "406 not acceptable", http.StatusNotAcceptable)
+		return
+	}
+	if _, haveType := w.Header()["Content-Type"]; !haveType {
+		ctype, err := variantContentType(name, variants[""])
+		if err != nil {
+			http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", ctype)
+	}
+	if etag := w.Header().Get("Etag"); etag != "" && coding != "" {
+		w.Header().Set("Etag", variantETag(etag, coding))
+	}
+	if ir := r.Header.Get("If-Range"); isConneg && ir != "" && !isETag(ir) && r.Header.Get("Range") != "" {
+		r = cloneRequest(r)
+		r.Header.Del("Range")
+	}
+	http.ServeContent(&responseWithContentEncoding{w: w, encoding: coding, isConneg: isConneg}, r, name, modtime, variants[coding])
+}
+
+// negotiateVariant returns the preferred coding, among the variants' keys,
+// that's acceptable according to the given Accept-Encoding header.
+func negotiateVariant(ae string, variants map[string]io.ReadSeeker) (string, bool) {
+	cs := make([]string, 0, len(variants))
+	for c := range variants {
+		if c != "" {
+			cs = append(cs, c)
+		}
+	}
+	sortCodings(cs)
+	for _, c := range cs {
+		if hasToken(ae, c) {
+			return c, true
+		}
+	}
+	_, ok := variants[""]
+	return "", ok
+}
+
+// variantContentType determines the Content-Type from the name's extension
+// or, failing that, by sniffing the identity content (if any), in which case
+// the content is rewound to its start.
+func variantContentType(name string, identity io.ReadSeeker) (string, error) {
+	if ctype := typeByExtension(filepath.Ext(name), nil); ctype != "" {
+		return ctype, nil
+	}
+	if identity == nil {
+		return "application/octet-stream", nil
+	}
+	var buf [512]byte
+	n, _ := io.ReadFull(identity, buf[:])
+	if _, err := identity.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// variantETag makes the given ETag specific to the given coding.
+func variantETag(etag, coding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + coding + `"`
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var modtime = time.Date(2016, time.November, 2, 10, 0, 0, 0, time.UTC)
+
+func newVariants(codings ...string) map[string]io.ReadSeeker {
+	variants := make(map[string]io.ReadSeeker, len(codings))
+	for _, c := range codings {
+		variants[c] = strings.NewReader("<!DOCTYPE html>variant[" + c + "]")
+	}
+	return variants
+}
+
+func TestServeVariants(t *testing.T) {
+	testData := []struct {
+		name                string
+		codings             []string
+		acceptEncoding      string
+		wantCode            int
+		wantContentType     string
+		wantContentEncoding string
+		wantVary            string
+	}{
+		{"foo.html", []string{""}, "gzip", http.StatusOK, "text/html; charset=utf-8", "", ""},
+		{"foo.html", []string{"", "gzip"}, "", http.StatusOK, "text/html; charset=utf-8", "", "Accept-Encoding"},
+		{"foo.html", []string{"", "gzip"}, "gzip", http.StatusOK, "text/html; charset=utf-8", "gzip", "Accept-Encoding"},
+		{"foo.html", []string{"", "gzip", "br"}, "gzip", http.StatusOK, "text/html; charset=utf-8", "gzip", "Accept-Encoding"},
+		{"foo.html", []string{"", "gzip", "br"}, "gzip, br", http.StatusOK, "text/html; charset=utf-8", "br", "Accept-Encoding"},
+		{"foo.html", []string{"", "gzip", "zstd", "br"}, "gzip, zstd", http.StatusOK, "text/html; charset=utf-8", "zstd", "Accept-Encoding"},
+		{"foo.html", []string{"", "deflate", "gzip"}, "deflate, gzip", http.StatusOK, "text/html; charset=utf-8", "gzip", "Accept-Encoding"},
+		{"foo.html", []string{"gzip"}, "gzip", http.StatusOK, "text/html; charset=utf-8", "gzip", "Accept-Encoding"},
+		{"foo.html", []string{"gzip"}, "br", http.StatusNotAcceptable, "text/plain; charset=utf-8", "", "Accept-Encoding"},
+		// Content sniffing, only on the identity variant
+		{"foo", []string{"", "gzip"}, "gzip", http.StatusOK, "text/html; charset=utf-8", "gzip", "Accept-Encoding"},
+		{"foo", []string{"gzip"}, "gzip", http.StatusOK, "application/octet-stream", "gzip", "Accept-Encoding"},
+	}
+	for _, tt := range testData {
+		variants := newVariants(tt.codings...)
+		req := httptest.NewRequest("GET", "/"+tt.name, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		ServeVariants(rec, req, tt.name, modtime, variants)
+
+		test := tt.name + strings.Join(tt.codings, "|") + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Type"), tt.wantContentType; g != e {
+			t.Errorf("test %s: content-type = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Vary"), tt.wantVary; g != e {
+			t.Errorf("test %s: vary = %q, want %q", test, g, e)
+		}
+		if tt.wantCode == http.StatusOK {
+			if g, e := rec.Body.String(), "<!DOCTYPE html>variant["+tt.wantContentEncoding+"]"; g != e {
+				t.Errorf("test %s: body = %q, want %q", test, g, e)
+			}
+		}
+	}
+}
+
+func TestServeVariantsRangeAndConditional(t *testing.T) {
+	req := httptest.NewRequest("GET", "/foo.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=15-21")
+	rec := httptest.NewRecorder()
+	ServeVariants(rec, req, "foo.html", modtime, newVariants("", "gzip"))
+
+	if g, e := rec.Code, http.StatusPartialContent; g != e {
+		t.Errorf("range: status = %d, want %d", g, e)
+	}
+	if g, e := rec.Header().Get("Content-Encoding"), "gzip"; g != e {
+		t.Errorf("range: content-encoding = %q, want %q", g, e)
+	}
+	if g, e := rec.Body.String(), "variant"; g != e {
+		t.Errorf("range: body = %q, want %q", g, e)
+	}
+
+	req = httptest.NewRequest("GET", "/foo.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-Modified-Since", modtime.Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	ServeVariants(rec, req, "foo.html", modtime, newVariants("", "gzip"))
+
+	if g, e := rec.Code, http.StatusNotModified; g != e {
+		t.Errorf("conditional: status = %d, want %d", g, e)
+	}
+	if g, e := rec.Header().Get("Vary"), "Accept-Encoding"; g != e {
+		t.Errorf("conditional: vary = %q, want %q", g, e)
+	}
+}
+
+func TestServeVariantsETag(t *testing.T) {
+	for _, tt := range []struct {
+		etag, acceptEncoding, wantETag string
+	}{
+		{`"abc"`, "", `"abc"`},
+		{`"abc"`, "gzip", `"abc-gzip"`},
+		{`W/"abc"`, "br", `W/"abc-br"`},
+	} {
+		req := httptest.NewRequest("GET", "/foo.html", nil)
+		req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		rec := httptest.NewRecorder()
+		rec.Header().Set("Etag", tt.etag)
+		ServeVariants(rec, req, "foo.html", modtime, newVariants("", "gzip", "br"))
+
+		if g, e := rec.Header().Get("Etag"), tt.wantETag; g != e {
+			t.Errorf("test %s[%s]: etag = %s, want %s", tt.etag, tt.acceptEncoding, g, e)
+		}
+	}
+
+	// Date-based If-Range cannot tell variants apart
+	req := httptest.NewRequest("GET", "/foo.html", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("Range", "bytes=0-1")
+	req.Header.Set("If-Range", modtime.Format(http.TimeFormat))
+	rec := httptest.NewRecorder()
+	ServeVariants(rec, req, "foo.html", modtime, newVariants("", "gzip"))
+	if g, e := rec.Code, http.StatusOK; g != e {
+		t.Errorf("test date if-range: status = %d, want %d", g, e)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ZipFileServer returns a handler that serves HTTP requests with the contents
+// of the given ZIP archive.
+//
+// Deflate-compressed entries are sent as-is (without recompression) to
+// clients accepting gzip, wrapped with a gzip header and trailer built from
+// the archive's central directory. Entries are only decompressed for clients
+// that don't accept gzip.
+//
+// As a special case, the returned file server redirects any request
+// ending in "/index.html" to the same path, without the final
+// "index.html"; just like the standard http.FileServer.
+// Directory listings are not supported though.
+func ZipFileServer(z *zip.Reader) http.Handler {
+	return &ZipHandler{Reader: z}
+}
+
+// A ZipHandler is an http.Handler that serves HTTP requests with the contents
+// of a ZIP archive.
+//
+// ZipFileServer returns a ZipHandler whose only field set is Reader.
+type ZipHandler struct {
+	// Reader is the ZIP archive containing the files to serve.
+	Reader *zip.Reader
+
+	// RawDeflate enables sending Deflate-compressed entries as-is to clients
+	// accepting the deflate coding.
+	//
+	// Note that the deflate coding is defined as a zlib stream (RFC 1950)
+	// but ZIP archives contain raw deflate streams (RFC 1951). Most browsers
+	// accept both, but other clients might not, so this is disabled by
+	// default; gzip is always available anyway.
+	RawDeflate bool
+
+	once  sync.Once
+	files map[string]*zip.File
+}
+
+func (z *ZipHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	z.once.Do(z.index)
+
+	p := r.URL.Path
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if strings.HasSuffix(p, "/index.html") {
+		localRedirect(w, r, "./")
+		return
+	}
+	name := path.Clean(p)[1:]
+	if strings.HasSuffix(p, "/") {
+		name = path.Join(name, "index.html")
+	}
+	f := z.files[name]
+	if f == nil {
+		if _, isDir := z.files[path.Join(name, "index.html")]; isDir && !strings.HasSuffix(p, "/") {
+			localRedirect(w, r, path.Base(p)+"/")
+			return
+		}
+		http.NotFound(w, r)
+		return
+	}
+
+	variants := make(map[string]io.ReadSeeker, 3)
+	switch raw, err := f.OpenRaw(); {
+	case err != nil:
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	case f.Method == zip.Store && isReadSeeker(raw):
+		variants[""] = raw.(io.ReadSeeker)
+	case f.Method == zip.Deflate && isReadSeeker(raw):
+		variants["gzip"] = newGzipFraming(f, raw.(io.ReadSeeker))
+		if z.RawDeflate {
+			variants["deflate"] = raw.(io.ReadSeeker)
+		}
+		fallthrough
+	default:
+		er := &zipEntryReader{f: f}
+		defer er.Close()
+		variants[""] = er
+	}
+	w.Header().Set("Etag", makeETag(strconv.FormatUint(uint64(f.CRC32), 36)+"-"+strconv.FormatUint(f.UncompressedSize64, 36), ""))
+	ServeVariants(w, r, name, f.Modified, variants)
+}
+
+func (z *ZipHandler) index() {
+	z.files = make(map[string]*zip.File, len(z.Reader.File))
+	for _, f := range z.Reader.File {
+		if !strings.HasSuffix(f.Name, "/") {
+			z.files[path.Clean(f.Name)] = f
+		}
+	}
+}
+
+func isReadSeeker(r io.Reader) bool {
+	_, ok := r.(io.ReadSeeker)
+	return ok
+}
+
+// localRedirect gives a Moved Permanently response.
+// It does not convert relative paths to absolute paths like http.Redirect does.
+func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
+	if q := r.URL.RawQuery; q != "" {
+		newPath += "?" + q
+	}
+	w.Header().Set("Location", newPath)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+// newGzipFraming returns the raw deflate stream of f wrapped into a gzip
+// header and trailer (RFC 1952).
+func newGzipFraming(f *zip.File, raw io.ReadSeeker) io.ReadSeeker {
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+	if mtime := f.Modified.Unix(); mtime > 0 && mtime <= 0xffffffff {
+		binary.LittleEndian.PutUint32(header[4:8], uint32(mtime))
+	}
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[0:4], f.CRC32)
+	binary.LittleEndian.PutUint32(trailer[4:8], uint32(f.UncompressedSize64))
+	return newMultiReadSeeker(bytes.NewReader(header), raw, bytes.NewReader(trailer))
+}
+
+// A multiReadSeeker is the logical concatenation of its parts.
+type multiReadSeeker struct {
+	parts []io.ReadSeeker
+	sizes []int64
+	size  int64
+	off   int64
+	err   error
+}
+
+func newMultiReadSeeker(parts ...io.ReadSeeker) io.ReadSeeker {
+	m := &multiReadSeeker{parts: parts, sizes: make([]int64, len(parts))}
+	for i, p := range parts {
+		n, err := p.Seek(0, io.SeekEnd)
+		if err != nil {
+			m.err = err
+			break
+		}
+		m.sizes[i] = n
+		m.size += n
+	}
+	return m
+}
+
+func (m *multiReadSeeker) Read(b []byte) (int, error) {
+	if m.err != nil {
+		return 0, m.err
+	}
+	start := int64(0)
+	for i, p := range m.parts {
+		if m.off < start+m.sizes[i] {
+			if _, err := p.Seek(m.off-start, io.SeekStart); err != nil {
+				return 0, err
+			}
+			if rem := start + m.sizes[i] - m.off; int64(len(b)) > rem {
+				b = b[:rem]
+			}
+			n, err := p.Read(b)
+			m.off += int64(n)
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		start += m.sizes[i]
+	}
+	return 0, io.EOF
+}
+
+func (m *multiReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return seek(&m.off, m.size, offset, whence)
+}
+
+var errNegativeOffset = errors.New("encneg: seek to negative offset")
+
+func seek(off *int64, size, offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += *off
+	case io.SeekEnd:
+		offset += size
+	}
+	if offset < 0 {
+		return 0, errNegativeOffset
+	}
+	*off = offset
+	return offset, nil
+}
+
+// A zipEntryReader is an io.ReadSeeker decompressing a ZIP archive entry.
+//
+// Seeking backwards is implemented by decompressing the entry again from the
+// start, so it's only efficient for the access patterns of http.ServeContent
+// (content sniffing and single ranges.)
+type zipEntryReader struct {
+	f   *zip.File
+	rc  io.ReadCloser
+	pos int64 // position in rc
+	off int64 // position requested by Seek
+}
+
+func (z *zipEntryReader) Read(b []byte) (int, error) {
+	if z.rc == nil || z.off < z.pos {
+		z.Close()
+		rc, err := z.f.Open()
+		if err != nil {
+			return 0, err
+		}
+		z.rc, z.pos = rc, 0
+	}
+	if z.off > z.pos {
+		n, err := io.CopyN(io.Discard, z.rc, z.off-z.pos)
+		z.pos += n
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := z.rc.Read(b)
+	z.pos += int64(n)
+	z.off = z.pos
+	return n, err
+}
+
+func (z *zipEntryReader) Seek(offset int64, whence int) (int64, error) {
+	return seek(&z.off, int64(z.f.UncompressedSize64), offset, whence)
+}
+
+func (z *zipEntryReader) Close() error {
+	if z.rc == nil {
+		return nil
+	}
+	err := z.rc.Close()
+	z.rc = nil
+	return err
+}
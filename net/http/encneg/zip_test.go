@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package encneg
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var zipContents = map[string]string{
+	"index.html":      strings.Repeat("<p>index</p>\n", 50),
+	"docs/index.html": strings.Repeat("<p>docs index</p>\n", 50),
+	"docs/foo.txt":    strings.Repeat("foo\n", 100),
+	"stored.txt":      "stored, not compressed",
+}
+
+func newZipReader(t *testing.T) *zip.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range zipContents {
+		method := zip.Deflate
+		if name == "stored.txt" {
+			method = zip.Store
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modtime})
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
+
+func TestZipFileServer(t *testing.T) {
+	zr := newZipReader(t)
+
+	testData := []struct {
+		path                string
+		acceptEncoding      string
+		rawDeflate          bool
+		wantCode            int
+		wantContentType     string
+		wantContentEncoding string
+		wantLocation        string
+		wantContent         string
+	}{
+		{"/", "", false, http.StatusOK, "text/html; charset=utf-8", "", "", zipContents["index.html"]},
+		{"/", "gzip", false, http.StatusOK, "text/html; charset=utf-8", "gzip", "", zipContents["index.html"]},
+		{"/docs/foo.txt", "", false, http.StatusOK, "text/plain; charset=utf-8", "", "", zipContents["docs/foo.txt"]},
+		{"/docs/foo.txt", "gzip", false, http.StatusOK, "text/plain; charset=utf-8", "gzip", "", zipContents["docs/foo.txt"]},
+		{"/docs/foo.txt", "deflate", false, http.StatusOK, "text/plain; charset=utf-8", "", "", zipContents["docs/foo.txt"]},
+		{"/docs/foo.txt", "deflate", true, http.StatusOK, "text/plain; charset=utf-8", "deflate", "", zipContents["docs/foo.txt"]},
+		{"/docs/foo.txt", "gzip, deflate", true, http.StatusOK, "text/plain; charset=utf-8", "gzip", "", zipContents["docs/foo.txt"]},
+		{"/stored.txt", "gzip", false, http.StatusOK, "text/plain; charset=utf-8", "", "", zipContents["stored.txt"]},
+		{"/docs", "", false, http.StatusMovedPermanently, "", "", "docs/", ""},
+		{"/docs/index.html", "", false, http.StatusMovedPermanently, "", "", "./", ""},
+		{"/missing.txt", "gzip", false, http.StatusNotFound, "text/plain; charset=utf-8", "", "", "404 page not found\n"},
+	}
+	for _, tt := range testData {
+		h := &ZipHandler{Reader: zr, RawDeflate: tt.rawDeflate}
+		req := httptest.NewRequest("GET", tt.path, nil)
+		if tt.acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		test := tt.path + "[" + tt.acceptEncoding + "]"
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %s: status = %d, want %d", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Type"), tt.wantContentType; g != e {
+			t.Errorf("test %s: content-type = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Content-Encoding"), tt.wantContentEncoding; g != e {
+			t.Errorf("test %s: content-encoding = %q, want %q", test, g, e)
+		}
+		if g, e := rec.Header().Get("Location"), tt.wantLocation; g != e {
+			t.Errorf("test %s: location = %q, want %q", test, g, e)
+		}
+		var body []byte
+		var err error
+		switch tt.wantContentEncoding {
+		case "gzip":
+			var r *gzip.Reader
+			if r, err = gzip.NewReader(rec.Body); err == nil {
+				// the gzip.Reader verifies the CRC-32 and size in the trailer
+				body, err = io.ReadAll(r)
+			}
+		case "deflate":
+			body, err = io.ReadAll(flate.NewReader(rec.Body))
+		default:
+			body = rec.Body.Bytes()
+		}
+		if err != nil {
+			t.Errorf("test %s: %v", test, err)
+		} else if g, e := string(body), tt.wantContent; g != e {
+			t.Errorf("test %s: body = %q, want %q", test, g, e)
+		}
+	}
+}
+
+func TestZipFileServerRange(t *testing.T) {
+	h := ZipFileServer(newZipReader(t))
+	for _, ae := range []string{"", "gzip"} {
+		req := httptest.NewRequest("GET", "/docs/foo.txt", nil)
+		req.Header.Set("Range", "bytes=0-1")
+		if ae != "" {
+			req.Header.Set("Accept-Encoding", ae)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if g, e := rec.Code, http.StatusPartialContent; g != e {
+			t.Errorf("test [%s]: status = %d, want %d", ae, g, e)
+		}
+		want := "fo"
+		if ae == "gzip" {
+			// gzip magic number
+			want = "\x1f\x8b"
+		}
+		if g, e := rec.Body.String(), want; g != e {
+			t.Errorf("test [%s]: body = %q, want %q", ae, g, e)
+		}
+	}
+}
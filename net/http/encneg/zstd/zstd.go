@@ -0,0 +1,41 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zstd registers the zstd content coding (Zstandard, RFC 8878) with
+// encneg, so that encneg.Transport and encneg.DecodeRequest support it.
+//
+// It's meant to be imported for its side effect:
+//
+//	import _ "go.ltgt.net/net/http/encneg/zstd"
+//
+// It's a separate package so that only programs that need Zstandard depend
+// on a Zstandard implementation.
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"go.ltgt.net/net/http/encneg"
+)
+
+// MaxWindowSize is the maximum window size of the zstd content coding, as
+// defined in RFC 9659. Decoding streams that need a larger window fails, and
+// encoded streams never use one.
+const MaxWindowSize = 8 << 20
+
+func init() {
+	encneg.RegisterCoding("zstd", encneg.Coding{
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(MaxWindowSize))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		},
+		NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(MaxWindowSize))
+		},
+	})
+}
@@ -0,0 +1,85 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zstd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"go.ltgt.net/net/http/encneg"
+)
+
+func TestTransport(t *testing.T) {
+	const content = "Hello World!"
+	var gotAE string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAE = r.Header.Get("Accept-Encoding")
+		w.Header().Set("Content-Encoding", "zstd")
+		ew := newWriter(t, w)
+		io.WriteString(ew, content)
+		ew.Close()
+	}))
+	defer srv.Close()
+
+	resp, err := (&http.Client{Transport: &encneg.Transport{}}).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Error(err)
+	}
+	if !strings.Contains(gotAE, "zstd") {
+		t.Errorf("accept-encoding = %q, want zstd", gotAE)
+	}
+	if !resp.Uncompressed {
+		t.Errorf("response was not decoded")
+	}
+	if g, e := string(body), content; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
+
+func TestDecodeRequest(t *testing.T) {
+	const content = `{"hello":"world"}`
+	var gotBody string
+	var gotErr error
+	handler := encneg.DecodeRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		gotBody, gotErr = string(b), err
+	}), nil)
+
+	var buf strings.Builder
+	ew := newWriter(t, &buf)
+	io.WriteString(ew, content)
+	ew.Close()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(buf.String()))
+	req.Header.Set("Content-Encoding", "zstd")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if g, e := rec.Code, http.StatusOK; g != e {
+		t.Errorf("status = %d, want %d", g, e)
+	}
+	if gotErr != nil {
+		t.Error(gotErr)
+	}
+	if g, e := gotBody, content; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
+
+func newWriter(t *testing.T, w io.Writer) io.WriteCloser {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zw
+}
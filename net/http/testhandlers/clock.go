@@ -0,0 +1,178 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"sync"
+	"time"
+)
+
+// A Clock tells the time and waits for durations to elapse.
+//
+// Handlers use the real time when their Clock is nil; tests can give them
+// a FakeClock to make delays deterministic.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	After(d time.Duration) <-chan time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer is a single event, that can be stopped before it fires, such as
+// to stop waiting when a request is canceled. See time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing. It returns false if the timer
+	// has already fired or been stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTimer(d time.Duration) Timer         { return realTimer{time.NewTimer(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+func (t realTimer) Stop() bool          { return t.t.Stop() }
+
+func clockOrDefault(c Clock) Clock {
+	if c == nil {
+		return realClock{}
+	}
+	return c
+}
+
+// A FakeClock is a Clock whose time only changes when calling Advance.
+// It's safe for concurrent use.
+//
+// The zero value is a FakeClock whose time is the zero time.
+type FakeClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+type fakeWaiter struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (w *fakeWaiter) C() <-chan time.Time { return w.c }
+
+// Stop removes the waiter from its clock, so it's no longer counted by
+// Waiters and BlockUntil.
+func (w *fakeWaiter) Stop() bool {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, o := range c.waiters {
+		if o == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// NewFakeClock returns a FakeClock whose time is initially now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// broadcast wakes up the goroutines blocked in BlockUntil. It must be called
+// with c.mu held.
+func (c *FakeClock) broadcast() {
+	if c.cond != nil {
+		c.cond.Broadcast()
+	}
+}
+
+// Now returns the clock's current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Sleep blocks until the clock has been advanced by at least d.
+func (c *FakeClock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// After returns a channel that receives the clock's time once it has been
+// advanced by at least d. If d is zero or negative, the channel receives
+// the current time immediately.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	return c.NewTimer(d).C()
+}
+
+// NewTimer returns a Timer that fires once the clock has been advanced by at
+// least d. If d is zero or negative, the timer fires immediately. Stopping
+// the timer removes it from the clock's waiters.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := &fakeWaiter{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+		return w
+	}
+	c.waiters = append(c.waiters, w)
+	c.broadcast()
+	return w
+}
+
+// Advance moves the clock's time forward by d, waking up the waiters whose
+// deadline has passed.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.deadline.After(c.now) {
+			waiters = append(waiters, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = waiters
+	c.broadcast()
+}
+
+// Waiters returns the number of pending calls to Sleep and After, and of
+// timers that haven't fired nor been stopped, i.e. the number of goroutines
+// waiting for the clock to be advanced.
+//
+// Handlers stop their timers when their request is canceled, so they're no
+// longer counted.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil blocks until there are at least n pending calls to Sleep and
+// After, or timers. Tests use it to wait for handlers running in other goroutines to
+// start waiting, before calling Advance.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.cond == nil {
+		c.cond = sync.NewCond(&c.mu)
+	}
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
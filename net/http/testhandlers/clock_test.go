@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2016, time.November, 2, 10, 0, 0, 0, time.UTC)
+	c := NewFakeClock(start)
+	if g, e := c.Now(), start; !g.Equal(e) {
+		t.Errorf("now = %v, want %v", g, e)
+	}
+
+	select {
+	case <-c.After(0):
+	default:
+		t.Errorf("After(0) didn't fire immediately")
+	}
+
+	a, b := c.After(time.Second), c.After(time.Minute)
+	if g, e := c.Waiters(), 2; g != e {
+		t.Errorf("waiters = %d, want %d", g, e)
+	}
+	c.Advance(999 * time.Millisecond)
+	select {
+	case <-a:
+		t.Errorf("After(1s) fired after 999ms")
+	default:
+	}
+	c.Advance(time.Millisecond)
+	select {
+	case now := <-a:
+		if e := start.Add(time.Second); !now.Equal(e) {
+			t.Errorf("After(1s) = %v, want %v", now, e)
+		}
+	default:
+		t.Errorf("After(1s) didn't fire after 1s")
+	}
+	if g, e := c.Waiters(), 1; g != e {
+		t.Errorf("waiters = %d, want %d", g, e)
+	}
+	c.Advance(time.Hour)
+	<-b
+	if g, e := c.Now(), start.Add(time.Second+time.Hour); !g.Equal(e) {
+		t.Errorf("now = %v, want %v", g, e)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Sleep(time.Second)
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	<-done
+	if g, e := c.Waiters(), 0; g != e {
+		t.Errorf("waiters = %d, want %d", g, e)
+	}
+}
+
+func TestFakeClockZeroValue(t *testing.T) {
+	var c FakeClock
+	if g := c.Now(); !g.IsZero() {
+		t.Errorf("now = %v, want zero time", g)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.Sleep(time.Second)
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	<-done
+}
+
+func TestFakeClockTimerStop(t *testing.T) {
+	c := NewFakeClock(time.Now())
+	a, b := c.NewTimer(time.Second), c.NewTimer(time.Second)
+	if g, e := c.Waiters(), 2; g != e {
+		t.Errorf("waiters = %d, want %d", g, e)
+	}
+	if !a.Stop() {
+		t.Errorf("Stop() = false for a pending timer")
+	}
+	if a.Stop() {
+		t.Errorf("Stop() = true for a stopped timer")
+	}
+	if g, e := c.Waiters(), 1; g != e {
+		t.Errorf("waiters after stop = %d, want %d", g, e)
+	}
+	c.Advance(time.Second)
+	select {
+	case <-a.C():
+		t.Errorf("stopped timer fired")
+	default:
+	}
+	select {
+	case <-b.C():
+	default:
+		t.Errorf("timer didn't fire after 1s")
+	}
+	if b.Stop() {
+		t.Errorf("Stop() = true for a fired timer")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// An EchoedRequest is the JSON description of a request, as sent by Echo.
+type EchoedRequest struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	Proto      string      `json:"proto"`
+	Host       string      `json:"host"`
+	RemoteAddr string      `json:"remoteAddr"`
+	Header     http.Header `json:"header"`
+	Trailer    http.Header `json:"trailer,omitempty"`
+	TLS        *EchoedTLS  `json:"tls,omitempty"`
+
+	// Body is the request body, either raw or base64-encoded depending on
+	// the 'echo_body' query parameter; it's absent when only hashed.
+	Body       string `json:"body,omitempty"`
+	BodySize   int64  `json:"bodySize"`
+	BodySHA256 string `json:"bodySha256"`
+}
+
+// An EchoedTLS describes the TLS connection of an EchoedRequest.
+type EchoedTLS struct {
+	Version            string `json:"version"`
+	CipherSuite        string `json:"cipherSuite"`
+	ServerName         string `json:"serverName,omitempty"`
+	NegotiatedProtocol string `json:"negotiatedProtocol,omitempty"`
+}
+
+// Echo returns a handler that responds with a JSON description of the
+// request (see EchoedRequest).
+//
+// The request body is echoed as-is by default, along with its size and
+// SHA-256 hash (in hex). A query parameter named 'echo_body' changes that:
+// with a value of 'hash', only the size and hash are sent; with a value of
+// 'base64', the body is base64-encoded (for binary content.)
+//
+// It can be wrapped with other handlers of this package, such as:
+//
+//	testhandlers.Delay(testhandlers.AddHeaders(testhandlers.Echo()))
+func Echo() http.Handler {
+	return http.HandlerFunc(echo)
+}
+
+func echo(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256(body)
+	e := &EchoedRequest{
+		Method:     r.Method,
+		URL:        r.URL.String(),
+		Proto:      r.Proto,
+		Host:       r.Host,
+		RemoteAddr: r.RemoteAddr,
+		Header:     r.Header,
+		Trailer:    r.Trailer,
+		BodySize:   int64(len(body)),
+		BodySHA256: hex.EncodeToString(sum[:]),
+	}
+	switch r.URL.Query().Get("echo_body") {
+	case "hash":
+	case "base64":
+		e.Body = base64.StdEncoding.EncodeToString(body)
+	default:
+		e.Body = string(body)
+	}
+	if cs := r.TLS; cs != nil {
+		e.TLS = &EchoedTLS{
+			Version:            tls.VersionName(cs.Version),
+			CipherSuite:        tls.CipherSuiteName(cs.CipherSuite),
+			ServerName:         cs.ServerName,
+			NegotiatedProtocol: cs.NegotiatedProtocol,
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEcho(t *testing.T) {
+	testData := []struct {
+		target   string
+		wantBody string
+	}{
+		{"/foo?bar=baz", "hello"},
+		{"/foo?echo_body=hash", ""},
+		{"/foo?echo_body=base64", "aGVsbG8="},
+	}
+	for _, tt := range testData {
+		req := httptest.NewRequest("POST", tt.target, strings.NewReader("hello"))
+		req.Header.Set("X-Foo", "bar")
+		rec := httptest.NewRecorder()
+		Echo().ServeHTTP(rec, req)
+
+		if g, e := rec.Header().Get("Content-Type"), "application/json"; g != e {
+			t.Errorf("test %q: content-type = %q, want %q", tt.target, g, e)
+		}
+		var got EchoedRequest
+		if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+			t.Errorf("test %q: %v", tt.target, err)
+			continue
+		}
+		if g, e := got.Method, "POST"; g != e {
+			t.Errorf("test %q: method = %q, want %q", tt.target, g, e)
+		}
+		if g, e := got.URL, tt.target; g != e {
+			t.Errorf("test %q: url = %q, want %q", tt.target, g, e)
+		}
+		if g, e := got.Host, "example.com"; g != e {
+			t.Errorf("test %q: host = %q, want %q", tt.target, g, e)
+		}
+		if g, e := got.Header.Get("X-Foo"), "bar"; g != e {
+			t.Errorf("test %q: x-foo = %q, want %q", tt.target, g, e)
+		}
+		if g, e := got.Body, tt.wantBody; g != e {
+			t.Errorf("test %q: body = %q, want %q", tt.target, g, e)
+		}
+		if g, e := got.BodySize, int64(5); g != e {
+			t.Errorf("test %q: body size = %d, want %d", tt.target, g, e)
+		}
+		if g, e := got.BodySHA256, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824"; g != e {
+			t.Errorf("test %q: body hash = %q, want %q", tt.target, g, e)
+		}
+		if got.TLS != nil {
+			t.Errorf("test %q: tls = %+v, want none", tt.target, got.TLS)
+		}
+	}
+}
+
+func TestEchoTLS(t *testing.T) {
+	s := httptest.NewTLSServer(AddHeaders(Echo()))
+	defer s.Close()
+
+	req, _ := http.NewRequest("GET", s.URL+"/?header=X-Foo:bar", nil)
+	req.Header.Set("X-Bar", "baz")
+	res, err := s.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var got EchoedRequest
+	if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := res.Header.Get("X-Foo"), "bar"; g != e {
+		t.Errorf("x-foo = %q, want %q", g, e)
+	}
+	if g, e := got.Header.Get("X-Bar"), "baz"; g != e {
+		t.Errorf("x-bar = %q, want %q", g, e)
+	}
+	if got.TLS == nil || got.TLS.Version == "" || got.TLS.CipherSuite == "" {
+		t.Errorf("tls = %+v, want TLS info", got.TLS)
+	}
+	if got.RemoteAddr == "" {
+		t.Errorf("remote address missing")
+	}
+}
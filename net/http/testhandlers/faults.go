@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+)
+
+// Faults wraps an http.Handler to simulate network failures based on the
+// request's query-string, expecting a query parameter named 'fault' whose
+// value is one of:
+//
+//   - 'reset' aborts the connection with a TCP RST, without responding
+//     (with TLS, the underlying TCP connection is reset)
+//   - 'close_after=N' sends the wrapped handler's response headers (with
+//     a Content-Length for the whole body) and the first N bytes of its body,
+//     then closes the connection
+//   - 'bad_chunk' sends the wrapped handler's response with a chunked
+//     Transfer-Encoding, and a malformed chunk after the first one
+//   - 'content_length_mismatch' sends the wrapped handler's response with
+//     a Content-Length one byte larger than the body, then closes the
+//     connection
+//   - 'hang' never responds, until the client gives up
+//
+// Except for 'hang', faults take over the connection using http.Hijacker,
+// so they're only supported with HTTP/1.x; the response has a 500 status
+// code otherwise. The wrapped handler's response is buffered.
+//
+// The wrapped handler is called normally in case the 'fault' query parameter
+// is absent or its value is unknown.
+func Faults(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !serveFault(w, r, h, r.URL.Query().Get("fault")) {
+			h.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serveFault simulates the given fault (see Faults), using h to produce the
+// response if needed. It reports false if the fault is unknown, in which case
+// nothing has been sent.
+func serveFault(w http.ResponseWriter, r *http.Request, h http.Handler, fault string) bool {
+	closeAfter := -1
+	if n := strings.TrimPrefix(fault, "close_after="); n != fault {
+		var err error
+		if closeAfter, err = strconv.Atoi(n); err != nil || closeAfter < 0 {
+			return false
+		}
+		fault = "close_after"
+	}
+	switch fault {
+	case "hang":
+		<-r.Context().Done()
+		return true
+	case "reset", "close_after", "bad_chunk", "content_length_mismatch":
+	default:
+		return false
+	}
+
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "testhandlers: faults need an http.Hijacker", http.StatusInternalServerError)
+		return true
+	}
+	var res *http.Response
+	if fault != "reset" {
+		// Keep the headers set by outer handlers, such as AddHeaders
+		rec := httptest.NewRecorder()
+		for k, v := range w.Header() {
+			rec.Header()[k] = append([]string(nil), v...)
+		}
+		h.ServeHTTP(rec, r)
+		res = rec.Result()
+	}
+	conn, bufrw, err := hj.Hijack()
+	if err != nil {
+		return true
+	}
+	defer conn.Close()
+
+	switch fault {
+	case "reset":
+		// Reset the underlying TCP connection, without a TLS close_notify
+		nc := conn
+		if tc, ok := nc.(*tls.Conn); ok {
+			nc = tc.NetConn()
+		}
+		if tc, ok := nc.(*net.TCPConn); ok {
+			tc.SetLinger(0)
+		}
+		nc.Close()
+		return true
+	case "close_after":
+		body := readBody(res)
+		writeResponseHeader(bufrw, res, "Content-Length: "+strconv.Itoa(len(body)))
+		if closeAfter < len(body) {
+			body = body[:closeAfter]
+		}
+		bufrw.Write(body)
+	case "bad_chunk":
+		body := readBody(res)
+		writeResponseHeader(bufrw, res, "Transfer-Encoding: chunked")
+		if len(body) > 0 {
+			fmt.Fprintf(bufrw, "%x\r\n%s\r\n", len(body), body)
+		}
+		bufrw.WriteString("not-a-chunk-size\r\n")
+	case "content_length_mismatch":
+		body := readBody(res)
+		writeResponseHeader(bufrw, res, "Content-Length: "+strconv.Itoa(len(body)+1))
+		bufrw.Write(body)
+	}
+	bufrw.Flush()
+	return true
+}
+
+// writeResponseHeader writes the status line and headers of the recorded
+// response, with the given framing header (replacing any Content-Length or
+// Transfer-Encoding.)
+func writeResponseHeader(w *bufio.ReadWriter, res *http.Response, framing string) {
+	h := res.Header
+	h.Del("Content-Length")
+	h.Del("Transfer-Encoding")
+	h.Set("Connection", "close")
+	fmt.Fprintf(w, "HTTP/1.1 %d %s\r\n", res.StatusCode, http.StatusText(res.StatusCode))
+	h.Write(w)
+	w.WriteString(framing + "\r\n\r\n")
+}
+
+// readBody returns the body of the recorded response.
+func readBody(res *http.Response) []byte {
+	body, _ := io.ReadAll(res.Body)
+	return body
+}
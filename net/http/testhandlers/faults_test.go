@@ -0,0 +1,117 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFaults(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "bar")
+		io.WriteString(w, "hello world")
+		// Too late, the headers have been sent
+		w.Header().Set("X-Late", "late")
+	})
+	s := httptest.NewServer(AddHeaders(Faults(handler)))
+	defer s.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	testData := []struct {
+		target      string
+		wantGetErr  bool
+		wantReadErr bool
+		wantBody    string
+	}{
+		{target: "/", wantBody: "hello world"},
+		{target: "/?fault=unknown", wantBody: "hello world"},
+		{target: "/?fault=close_after=invalid", wantBody: "hello world"},
+		{target: "/?fault=reset", wantGetErr: true},
+		{target: "/?fault=close_after=5", wantReadErr: true, wantBody: "hello"},
+		{target: "/?fault=close_after=0", wantReadErr: true, wantBody: ""},
+		{target: "/?fault=bad_chunk", wantReadErr: true, wantBody: "hello world"},
+		{target: "/?fault=content_length_mismatch", wantReadErr: true, wantBody: "hello world"},
+	}
+	for _, tt := range testData {
+		target := tt.target + "&header=X-Outer:baz"
+		if !strings.Contains(tt.target, "?") {
+			target = tt.target + "?header=X-Outer:baz"
+		}
+		res, err := client.Get(s.URL + target)
+		if tt.wantGetErr {
+			if err == nil {
+				res.Body.Close()
+				t.Errorf("test %q: expected error", tt.target)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("test %q: %v", tt.target, err)
+			continue
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if g, e := err != nil, tt.wantReadErr; g != e {
+			t.Errorf("test %q: read error = %v", tt.target, err)
+		}
+		if g, e := string(body), tt.wantBody; g != e {
+			t.Errorf("test %q: body = %q, want %q", tt.target, g, e)
+		}
+		if g, e := res.Header.Get("X-Foo"), "bar"; g != e {
+			t.Errorf("test %q: x-foo = %q, want %q", tt.target, g, e)
+		}
+		if g, e := res.Header.Get("X-Outer"), "baz"; g != e {
+			t.Errorf("test %q: x-outer = %q, want %q", tt.target, g, e)
+		}
+		if g, e := res.Header.Get("X-Late"), ""; g != e {
+			t.Errorf("test %q: x-late = %q, want %q", tt.target, g, e)
+		}
+	}
+}
+
+func TestFaultsReset(t *testing.T) {
+	for _, s := range []*httptest.Server{
+		httptest.NewServer(Faults(http.NotFoundHandler())),
+		httptest.NewTLSServer(Faults(http.NotFoundHandler())),
+	} {
+		defer s.Close()
+		client := s.Client()
+		client.Timeout = 5 * time.Second
+		res, err := client.Get(s.URL + "/?fault=reset")
+		if err == nil {
+			res.Body.Close()
+			t.Errorf("test %s: expected error", s.URL)
+		} else if !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("test %s: err = %v, want a connection reset", s.URL, err)
+		}
+	}
+}
+
+func TestFaultsHang(t *testing.T) {
+	s := httptest.NewServer(Faults(http.NotFoundHandler()))
+	// Close would block if the handler was still running
+	defer s.Close()
+
+	client := &http.Client{Timeout: 50 * time.Millisecond}
+	if res, err := client.Get(s.URL + "/?fault=hang"); err == nil {
+		res.Body.Close()
+		t.Errorf("expected timeout, got %s", res.Status)
+	}
+}
+
+func TestFaultsNotHijacker(t *testing.T) {
+	req := httptest.NewRequest("", "/?fault=reset", nil)
+	rec := httptest.NewRecorder()
+	Faults(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if g, e := rec.Code, http.StatusInternalServerError; g != e {
+		t.Errorf("status = %d, want %d", g, e)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// FlakyOptions configures the failures injected by Flaky.
+type FlakyOptions struct {
+	// Rate is the fraction of requests that fail, between 0 and 1.
+	// It can be overridden by a query parameter named 'flaky'.
+	Rate float64
+
+	// Seed seeds the random number generator deciding which requests fail
+	// and how. It can be overridden by a query parameter named 'seed'.
+	Seed int64
+
+	// Statuses are the status codes of failed responses.
+	Statuses []int
+
+	// MaxDelay is the maximum duration a request can be delayed before
+	// being passed to the wrapped handler.
+	MaxDelay time.Duration
+
+	// Faults are the connection-level faults that can be simulated, as
+	// values of the 'fault' query parameter of Faults (such as "reset" or
+	// "close_after=512".)
+	Faults []string
+
+	// Clock is used to delay requests. If nil, the real time is used.
+	Clock Clock
+}
+
+// defaultFlakyStatuses are the status codes used when no failure is
+// configured.
+var defaultFlakyStatuses = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// Flaky wraps an http.Handler to make a fraction of the requests fail, in one
+// of the following ways, chosen at random among those configured in opts:
+//
+//   - respond with one of the Statuses, without calling the wrapped handler
+//   - delay the request by up to MaxDelay, then call the wrapped handler
+//   - simulate one of the Faults (see Faults)
+//
+// If none is configured, failures are 500, 502, 503 or 504 responses.
+//
+// Failures are decided by a random number generator seeded with opts.Seed,
+// so a sequence of requests fails the same way each time. A 'seed' query
+// parameter selects another generator, seeded with its value (generators
+// are kept for the lifetime of the handler), and a 'flaky' query parameter
+// overrides opts.Rate:
+//
+//	GET /path?flaky=0.3&seed=42
+//
+// Note that with concurrent requests, failures depend on the order in which
+// requests are received.
+func Flaky(h http.Handler, opts FlakyOptions) http.Handler {
+	if len(opts.Statuses) == 0 && opts.MaxDelay <= 0 && len(opts.Faults) == 0 {
+		opts.Statuses = defaultFlakyStatuses
+	}
+	return &flakyHandler{
+		h:    h,
+		opts: opts,
+		rngs: map[int64]*rand.Rand{opts.Seed: rand.New(rand.NewSource(opts.Seed))},
+	}
+}
+
+type flakyHandler struct {
+	h    http.Handler
+	opts FlakyOptions
+
+	mu   sync.Mutex
+	rngs map[int64]*rand.Rand
+}
+
+// A flakyFailure is the failure chosen for a request.
+type flakyFailure struct {
+	status int
+	delay  time.Duration
+	fault  string
+}
+
+func (f *flakyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	rate, seed := f.opts.Rate, f.opts.Seed
+	if v, err := strconv.ParseFloat(q.Get("flaky"), 64); err == nil {
+		rate = v
+	}
+	if v, err := strconv.ParseInt(q.Get("seed"), 10, 64); err == nil {
+		seed = v
+	}
+
+	failure, ok := f.decide(seed, rate)
+	switch {
+	case !ok:
+		f.h.ServeHTTP(w, r)
+	case failure.status != 0:
+		http.Error(w, http.StatusText(failure.status), failure.status)
+	case failure.delay != 0:
+		if sleep(r.Context(), f.opts.Clock, failure.delay) {
+			f.h.ServeHTTP(w, r)
+		}
+	default:
+		if !serveFault(w, r, f.h, failure.fault) {
+			f.h.ServeHTTP(w, r)
+		}
+	}
+}
+
+// decide draws whether the request fails, and how, from the random number
+// generator for the given seed.
+func (f *flakyHandler) decide(seed int64, rate float64) (flakyFailure, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	rng := f.rngs[seed]
+	if rng == nil {
+		rng = rand.New(rand.NewSource(seed))
+		f.rngs[seed] = rng
+	}
+	if rng.Float64() >= rate {
+		return flakyFailure{}, false
+	}
+
+	var kinds []func() flakyFailure
+	if len(f.opts.Statuses) > 0 {
+		kinds = append(kinds, func() flakyFailure {
+			return flakyFailure{status: f.opts.Statuses[rng.Intn(len(f.opts.Statuses))]}
+		})
+	}
+	if f.opts.MaxDelay > 0 {
+		kinds = append(kinds, func() flakyFailure {
+			return flakyFailure{delay: time.Duration(rng.Int63n(int64(f.opts.MaxDelay))) + 1}
+		})
+	}
+	if len(f.opts.Faults) > 0 {
+		kinds = append(kinds, func() flakyFailure {
+			return flakyFailure{fault: f.opts.Faults[rng.Intn(len(f.opts.Faults))]}
+		})
+	}
+	return kinds[rng.Intn(len(kinds))](), true
+}
@@ -0,0 +1,119 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// flakyOutcomes returns the status codes of n successive requests.
+func flakyOutcomes(h http.Handler, target string, n int) []string {
+	outcomes := make([]string, n)
+	for i := range outcomes {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("", target, nil))
+		outcomes[i] = strconv.Itoa(rec.Code)
+	}
+	return outcomes
+}
+
+func TestFlaky(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+
+	// Failures are reproducible
+	for _, tt := range []struct {
+		opts   FlakyOptions
+		target string
+	}{
+		{FlakyOptions{Rate: 0.5, Seed: 42}, "/"},
+		{FlakyOptions{}, "/?flaky=0.5&seed=42"},
+	} {
+		a := flakyOutcomes(Flaky(handler, tt.opts), tt.target, 100)
+		b := flakyOutcomes(Flaky(handler, tt.opts), tt.target, 100)
+		if !areEqual(a, b) {
+			t.Errorf("test %+v%s: outcomes differ between runs:\n%v\n%v", tt.opts, tt.target, a, b)
+		}
+		var failures int
+		for _, o := range a {
+			switch o {
+			case "200":
+			case "500", "502", "503", "504":
+				failures++
+			default:
+				t.Errorf("test %+v%s: unexpected status %s", tt.opts, tt.target, o)
+			}
+		}
+		if failures < 30 || failures > 70 {
+			t.Errorf("test %+v%s: %d failures out of 100, want about 50", tt.opts, tt.target, failures)
+		}
+	}
+
+	// The seed selects the failures
+	h := Flaky(handler, FlakyOptions{Rate: 0.5})
+	if a, b := flakyOutcomes(h, "/?seed=1", 100), flakyOutcomes(h, "/?seed=2", 100); areEqual(a, b) {
+		t.Errorf("outcomes don't depend on the seed")
+	}
+
+	// Rate bounds
+	for _, rate := range []string{"0", "1"} {
+		for _, o := range flakyOutcomes(Flaky(handler, FlakyOptions{}), "/?flaky="+rate, 20) {
+			if (o == "200") != (rate == "0") {
+				t.Errorf("test flaky=%s: unexpected status %s", rate, o)
+			}
+		}
+	}
+
+	// Custom statuses
+	for _, o := range flakyOutcomes(Flaky(handler, FlakyOptions{Rate: 1, Statuses: []int{429}}), "/", 20) {
+		if o != "429" {
+			t.Errorf("test statuses: unexpected status %s", o)
+		}
+	}
+}
+
+func TestFlakyDelay(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	})
+	clock := NewFakeClock(time.Now())
+	h := Flaky(handler, FlakyOptions{Rate: 1, MaxDelay: time.Second, Clock: clock})
+
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, httptest.NewRequest("", "/", nil))
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-done
+	if g, e := rec.Body.String(), "ok"; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
+
+func TestFlakyFaults(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello world")
+	})
+	s := httptest.NewServer(Flaky(handler, FlakyOptions{Rate: 1, Faults: []string{"close_after=5"}}))
+	defer s.Close()
+
+	res, err := s.Client().Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if body, err := io.ReadAll(res.Body); err == nil || string(body) != "hello" {
+		t.Errorf("body = %q, err = %v; want %q and an error", body, err, "hello")
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Default limits of a Recorder.
+const (
+	DefaultMaxRequests = 100
+	DefaultMaxBodySize = 1 << 20
+)
+
+// A RecordedRequest is a request seen by a Recorder.
+type RecordedRequest struct {
+	// Request is a clone of the request. Its Body can be read
+	// independently of the Body field.
+	Request *http.Request
+
+	// Body is the request body, truncated to the Recorder's MaxBodySize.
+	Body          []byte
+	BodyTruncated bool
+
+	// Time is the time the request arrived.
+	Time time.Time
+
+	// Status is the status code of the response.
+	Status int
+}
+
+// A Recorder is an http.Handler that records the requests it sees before
+// passing them to the wrapped Handler, for tests to later make assertions on
+// what clients sent:
+//
+//	rec := &testhandlers.Recorder{Handler: testhandlers.AddHeaders(h)}
+//	s := httptest.NewServer(rec)
+//	…
+//	if err := rec.WaitFor(ctx, 1); err != nil {
+//		t.Fatal(err)
+//	}
+//	if got := rec.Last().Request.Header.Get("Authorization"); got == "" {
+//		t.Error("missing Authorization header")
+//	}
+//
+// Requests are recorded once the wrapped handler returns. To bound memory
+// usage, only the latest MaxRequests requests are kept, with at most
+// MaxBodySize bytes of body each; the wrapped handler still sees the
+// whole body.
+//
+// A Recorder is safe for concurrent use.
+type Recorder struct {
+	// Handler is the wrapped handler. If nil, requests get an empty
+	// response with a 200 (OK) status code.
+	Handler http.Handler
+
+	// MaxRequests is the maximum number of requests kept. If zero,
+	// DefaultMaxRequests is used.
+	MaxRequests int
+
+	// MaxBodySize is the maximum size of request bodies kept. If zero,
+	// DefaultMaxBodySize is used.
+	MaxBodySize int64
+
+	// Clock is used to timestamp requests. If nil, the real time is used.
+	Clock Clock
+
+	mu       sync.Mutex
+	requests []*RecordedRequest
+	count    int
+	changed  chan struct{} // closed and replaced on each new request
+}
+
+func (rr *Recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rec := &RecordedRequest{Time: clockOrDefault(rr.Clock).Now()}
+
+	max := rr.MaxBodySize
+	if max <= 0 {
+		max = DefaultMaxBodySize
+	}
+	if r.Body != nil && r.Body != http.NoBody {
+		read, err := io.ReadAll(io.LimitReader(r.Body, max+1))
+		rec.Body = read
+		if int64(len(read)) > max {
+			rec.Body, rec.BodyTruncated = read[:max], true
+		}
+		// Replay what's been read, then the rest of the body (or the error)
+		rest := io.Reader(r.Body)
+		if err != nil {
+			rest = errReader{err}
+		}
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(read), rest), r.Body}
+	}
+	rec.Request = r.Clone(r.Context())
+	rec.Request.Body = io.NopCloser(bytes.NewReader(rec.Body))
+
+	sw := &statusRecorder{ResponseWriter: w}
+	if rr.Handler != nil {
+		rr.Handler.ServeHTTP(sw, r)
+	}
+	rec.Status = sw.status
+	if rec.Status == 0 {
+		rec.Status = http.StatusOK
+	}
+	rr.record(rec)
+}
+
+func (rr *Recorder) record(rec *RecordedRequest) {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	max := rr.MaxRequests
+	if max <= 0 {
+		max = DefaultMaxRequests
+	}
+	if len(rr.requests) >= max {
+		n := copy(rr.requests, rr.requests[len(rr.requests)-max+1:])
+		rr.requests = rr.requests[:n]
+	}
+	rr.requests = append(rr.requests, rec)
+	rr.count++
+	if rr.changed != nil {
+		close(rr.changed)
+		rr.changed = nil
+	}
+}
+
+// Requests returns the recorded requests, oldest first.
+func (rr *Recorder) Requests() []*RecordedRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return append([]*RecordedRequest(nil), rr.requests...)
+}
+
+// Last returns the latest recorded request, or nil if there's none.
+func (rr *Recorder) Last() *RecordedRequest {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	if len(rr.requests) == 0 {
+		return nil
+	}
+	return rr.requests[len(rr.requests)-1]
+}
+
+// Count returns the number of requests recorded so far, including those
+// that are no longer kept.
+func (rr *Recorder) Count() int {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	return rr.count
+}
+
+// WaitFor blocks until at least n requests have been recorded (see Count),
+// or the context is done, in which case it returns the context's error.
+func (rr *Recorder) WaitFor(ctx context.Context, n int) error {
+	for {
+		rr.mu.Lock()
+		if rr.count >= n {
+			rr.mu.Unlock()
+			return nil
+		}
+		if rr.changed == nil {
+			rr.changed = make(chan struct{})
+		}
+		changed := rr.changed
+		rr.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Reset forgets all recorded requests.
+func (rr *Recorder) Reset() {
+	rr.mu.Lock()
+	defer rr.mu.Unlock()
+	rr.requests = nil
+	rr.count = 0
+}
+
+// A statusRecorder is an http.ResponseWriter that records the status code.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	if sr.status == 0 && code >= 200 {
+		sr.status = code
+	}
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(p []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(p)
+}
+
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := sr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("testhandlers: http.Hijacker not supported")
+	}
+	return hj.Hijack()
+}
+
+// errReader is an io.Reader always returning the same error.
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) { return 0, e.err }
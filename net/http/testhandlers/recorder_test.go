@@ -0,0 +1,115 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	var handlerBodies []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		handlerBodies = append(handlerBodies, string(b))
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+		}
+	})
+	start := time.Date(2016, time.November, 2, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	rr := &Recorder{Handler: handler, MaxRequests: 2, MaxBodySize: 5, Clock: clock}
+
+	if rr.Last() != nil {
+		t.Errorf("last = %v, want nil", rr.Last())
+	}
+	for _, target := range []string{"/first", "/second", "/missing"} {
+		req := httptest.NewRequest("POST", target, strings.NewReader("body of "+target))
+		req.Header.Set("X-Foo", target)
+		rr.ServeHTTP(httptest.NewRecorder(), req)
+		clock.Advance(time.Second)
+	}
+
+	if g, e := handlerBodies, []string{"body of /first", "body of /second", "body of /missing"}; !areEqual(g, e) {
+		t.Errorf("wrapped handler bodies = %q, want %q", g, e)
+	}
+	if g, e := rr.Count(), 3; g != e {
+		t.Errorf("count = %d, want %d", g, e)
+	}
+	reqs := rr.Requests()
+	if g, e := len(reqs), 2; g != e {
+		t.Fatalf("len(requests) = %d, want %d", g, e)
+	}
+	for i, tt := range []struct {
+		path   string
+		status int
+		time   time.Time
+	}{
+		{"/second", http.StatusOK, start.Add(time.Second)},
+		{"/missing", http.StatusNotFound, start.Add(2 * time.Second)},
+	} {
+		got := reqs[i]
+		if g, e := got.Request.URL.Path, tt.path; g != e {
+			t.Errorf("request %d: path = %q, want %q", i, g, e)
+		}
+		if g, e := got.Request.Header.Get("X-Foo"), tt.path; g != e {
+			t.Errorf("request %d: x-foo = %q, want %q", i, g, e)
+		}
+		if g, e := string(got.Body), "body "; g != e || !got.BodyTruncated {
+			t.Errorf("request %d: body = %q (truncated: %t), want %q (truncated)", i, g, got.BodyTruncated, e)
+		}
+		if b, _ := io.ReadAll(got.Request.Body); string(b) != "body " {
+			t.Errorf("request %d: request body = %q, want %q", i, b, "body ")
+		}
+		if g, e := got.Status, tt.status; g != e {
+			t.Errorf("request %d: status = %d, want %d", i, g, e)
+		}
+		if g, e := got.Time, tt.time; !g.Equal(e) {
+			t.Errorf("request %d: time = %v, want %v", i, g, e)
+		}
+	}
+	if g, e := rr.Last(), reqs[1]; g != e {
+		t.Errorf("last = %v, want %v", g, e)
+	}
+
+	rr.Reset()
+	if g, e := rr.Count(), 0; g != e {
+		t.Errorf("count after reset = %d, want %d", g, e)
+	}
+}
+
+func TestRecorderWaitFor(t *testing.T) {
+	rr := &Recorder{Handler: AddHeaders(http.NotFoundHandler())}
+	s := httptest.NewServer(rr)
+	defer s.Close()
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			res, err := s.Client().Get(s.URL + "/?header=X-Foo:bar")
+			if err == nil {
+				res.Body.Close()
+			}
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := rr.WaitFor(ctx, 2); err != nil {
+		t.Fatal(err)
+	}
+	if g, e := rr.Last().Request.URL.Query().Get("header"), "X-Foo:bar"; g != e {
+		t.Errorf("header query parameter = %q, want %q", g, e)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := rr.WaitFor(ctx, 3); err != context.DeadlineExceeded {
+		t.Errorf("WaitFor = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
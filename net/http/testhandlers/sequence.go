@@ -0,0 +1,143 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"io"
+	"net/http"
+	"sync"
+)
+
+// A Step is one of the responses of a Sequence.
+type Step struct {
+	// Status is the status code of the response; it defaults to
+	// http.StatusOK.
+	Status int
+
+	// Header contains headers to add to the response.
+	Header http.Header
+
+	// Body is the body of the response.
+	Body string
+
+	// Handler, if not nil, handles the request instead, ignoring the other
+	// fields. This allows using other handlers of this package (such as
+	// a Delay) as a step.
+	Handler http.Handler
+}
+
+func (s *Step) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.Handler != nil {
+		s.Handler.ServeHTTP(w, r)
+		return
+	}
+	for k, v := range s.Header {
+		w.Header()[k] = append(w.Header()[k], v...)
+	}
+	status := s.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, s.Body)
+}
+
+// A Sequence is an http.Handler that responds to successive requests for
+// a given path with successive steps, such as a couple errors before
+// a successful response, for testing retries:
+//
+//	seq := new(testhandlers.Sequence)
+//	seq.Add("/api", testhandlers.Step{Status: 503}, testhandlers.Step{Status: 503},
+//		testhandlers.Step{Body: "ok"})
+//
+// Requests for paths without steps get a 404 (Not Found) response, and
+// requests beyond the last step a 500 (Internal Server Error) response.
+//
+// A Sequence is safe for concurrent use; each step is used exactly once.
+// The zero value is an empty Sequence ready to use.
+type Sequence struct {
+	mu    sync.Mutex
+	steps map[string][]Step
+	next  map[string]int
+}
+
+// Add appends steps for the given path.
+func (s *Sequence) Add(path string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.steps == nil {
+		s.steps = make(map[string][]Step)
+		s.next = make(map[string]int)
+	}
+	s.steps[path] = append(s.steps[path], steps...)
+}
+
+// Reset removes the steps of all paths, leaving an empty Sequence.
+func (s *Sequence) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps, s.next = nil, nil
+}
+
+// Rewind rewinds the sequences of all paths to their first step, keeping the
+// steps.
+func (s *Sequence) Rewind() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.next {
+		delete(s.next, p)
+	}
+}
+
+// Consumed returns the number of requests received for the given path,
+// including requests beyond the last step.
+func (s *Sequence) Consumed(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next[path]
+}
+
+// Remaining returns the number of steps that haven't been used yet for the
+// given path.
+func (s *Sequence) Remaining(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n := len(s.steps[path]) - s.next[path]; n > 0 {
+		return n
+	}
+	return 0
+}
+
+// Done reports whether all the steps of all paths have been used, and no
+// request has been received beyond the last step.
+func (s *Sequence) Done() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p, steps := range s.steps {
+		if s.next[p] != len(steps) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Sequence) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	steps, ok := s.steps[r.URL.Path]
+	i := s.next[r.URL.Path]
+	if ok {
+		s.next[r.URL.Path]++
+	}
+	s.mu.Unlock()
+
+	switch {
+	case !ok:
+		http.NotFound(w, r)
+	case i >= len(steps):
+		http.Error(w, "testhandlers: no more steps in sequence", http.StatusInternalServerError)
+	default:
+		steps[i].ServeHTTP(w, r)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestSequence(t *testing.T) {
+	var seq Sequence
+	seq.Add("/foo",
+		Step{Status: http.StatusServiceUnavailable, Header: http.Header{"Retry-After": {"1"}}},
+		Step{Handler: Status(http.NotFoundHandler())},
+	)
+	seq.Add("/foo", Step{Body: "ok"})
+
+	testData := []struct {
+		target     string
+		wantCode   int
+		wantBody   string
+		wantHeader string
+	}{
+		{"/foo", http.StatusServiceUnavailable, "", "1"},
+		{"/foo?status=502", http.StatusBadGateway, "", ""},
+		{"/foo", http.StatusOK, "ok", ""},
+		{"/foo", http.StatusInternalServerError, "testhandlers: no more steps in sequence\n", ""},
+		{"/bar", http.StatusNotFound, "404 page not found\n", ""},
+	}
+	for i := 0; i < 2; i++ {
+		for _, tt := range testData {
+			req := httptest.NewRequest("", tt.target, nil)
+			rec := httptest.NewRecorder()
+			seq.ServeHTTP(rec, req)
+
+			if g, e := rec.Code, tt.wantCode; g != e {
+				t.Errorf("test %q: status = %d, want %d", tt.target, g, e)
+			}
+			if g, e := rec.Body.String(), tt.wantBody; g != e {
+				t.Errorf("test %q: body = %q, want %q", tt.target, g, e)
+			}
+			if g, e := rec.Header().Get("Retry-After"), tt.wantHeader; g != e {
+				t.Errorf("test %q: retry-after = %q, want %q", tt.target, g, e)
+			}
+		}
+		if g, e := seq.Consumed("/foo"), 4; g != e {
+			t.Errorf("consumed = %d, want %d", g, e)
+		}
+		if g, e := seq.Remaining("/foo"), 0; g != e {
+			t.Errorf("remaining = %d, want %d", g, e)
+		}
+		if seq.Done() {
+			t.Errorf("done = true after requests beyond the last step")
+		}
+		seq.Rewind()
+		if g, e := seq.Remaining("/foo"), 3; g != e {
+			t.Errorf("remaining after rewind = %d, want %d", g, e)
+		}
+	}
+
+	seq.Reset()
+	if g, e := seq.Remaining("/foo"), 0; g != e {
+		t.Errorf("remaining after reset = %d, want %d", g, e)
+	}
+	if !seq.Done() {
+		t.Errorf("done = false after reset")
+	}
+	rec := httptest.NewRecorder()
+	seq.ServeHTTP(rec, httptest.NewRequest("", "/foo", nil))
+	if g, e := rec.Code, http.StatusNotFound; g != e {
+		t.Errorf("status after reset = %d, want %d", g, e)
+	}
+	seq.Add("/foo", Step{Body: "ok"})
+	if g, e := seq.Remaining("/foo"), 1; g != e {
+		t.Errorf("remaining after reset and add = %d, want %d", g, e)
+	}
+}
+
+func TestSequenceConcurrent(t *testing.T) {
+	var seq Sequence
+	for i := 0; i < 50; i++ {
+		seq.Add("/", Step{})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			seq.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("", "/", nil))
+		}()
+	}
+	wg.Wait()
+	if !seq.Done() {
+		t.Errorf("done = false, remaining = %d", seq.Remaining("/"))
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// Status wraps an http.Handler to respond with a given status code based on
+// the request's query-string.
+//
+// With a query parameter named 'status' whose value is a status code, the
+// wrapped handler isn't called and the response has that status code.
+// Its body is the value of the 'body' query parameter if present, or made of
+// as many bytes as given by the 'body_size' query parameter; it's empty
+// otherwise.
+//
+// With a query parameter named 'override_status' whose value is a status
+// code, the wrapped handler is called but its response will have that status
+// code, whichever status code the handler used.
+//
+// Status codes must be between 200 and 999; the query parameters are ignored
+// otherwise.
+func Status(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if code := queryStatus(q, "status"); code != 0 {
+			writeStatus(w, code, q)
+			return
+		}
+		if code := queryStatus(q, "override_status"); code != 0 {
+			w = &statusWriter{ResponseWriter: w, code: code}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// queryStatus returns the status code in the named query parameter, or zero
+// if it's absent or invalid.
+func queryStatus(q url.Values, name string) int {
+	code, err := strconv.Atoi(q.Get(name))
+	if err != nil || code < 200 || code > 999 {
+		return 0
+	}
+	return code
+}
+
+func writeStatus(w http.ResponseWriter, code int, q url.Values) {
+	var body io.Reader
+	var size int64
+	if b, ok := q["body"]; ok {
+		body, size = bytes.NewReader([]byte(b[0])), int64(len(b[0]))
+	} else if n, err := strconv.ParseInt(q.Get("body_size"), 10, 64); err == nil && n > 0 {
+		body, size = io.LimitReader(filler{}, n), n
+	}
+	if body != nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	}
+	w.WriteHeader(code)
+	if body != nil {
+		io.Copy(w, body)
+	}
+}
+
+// filler is an io.Reader producing an endless stream of lowercase letters.
+type filler struct{}
+
+func (filler) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a' + byte(i%26)
+	}
+	return len(p), nil
+}
+
+// A statusWriter is an http.ResponseWriter that replaces the status code
+// used by the wrapped handler.
+type statusWriter struct {
+	http.ResponseWriter
+	code        int
+	wroteHeader bool
+}
+
+func (sw *statusWriter) WriteHeader(int) {
+	if sw.wroteHeader {
+		return
+	}
+	sw.wroteHeader = true
+	sw.ResponseWriter.WriteHeader(sw.code)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	sw.WriteHeader(http.StatusOK)
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatus(t *testing.T) {
+	var handlerCalled int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerCalled++
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "handler")
+	})
+
+	testData := []struct {
+		target            string
+		wantHandlerCalled bool
+		wantCode          int
+		wantBody          string
+	}{
+		{
+			target:            "/",
+			wantHandlerCalled: true,
+			wantCode:          http.StatusCreated,
+			wantBody:          "handler",
+		},
+		{
+			target:   "/?status=503",
+			wantCode: http.StatusServiceUnavailable,
+		},
+		{
+			target:   "/?status=429&body=slow+down",
+			wantCode: http.StatusTooManyRequests,
+			wantBody: "slow down",
+		},
+		{
+			target:   "/?status=500&body_size=30",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "abcdefghijklmnopqrstuvwxyzabcd",
+		},
+		{
+			target:   "/?status=500&body=&body_size=30",
+			wantCode: http.StatusInternalServerError,
+			wantBody: "",
+		},
+		{
+			target:            "/?status=invalid",
+			wantHandlerCalled: true,
+			wantCode:          http.StatusCreated,
+			wantBody:          "handler",
+		},
+		{
+			target:            "/?status=42",
+			wantHandlerCalled: true,
+			wantCode:          http.StatusCreated,
+			wantBody:          "handler",
+		},
+		{
+			target:            "/?override_status=502",
+			wantHandlerCalled: true,
+			wantCode:          http.StatusBadGateway,
+			wantBody:          "handler",
+		},
+	}
+	for _, tt := range testData {
+		handlerCalled = 0
+		req := httptest.NewRequest("", tt.target, nil)
+		rec := httptest.NewRecorder()
+		Status(handler).ServeHTTP(rec, req)
+
+		if g, e := handlerCalled == 1, tt.wantHandlerCalled; g != e {
+			t.Errorf("test %q: wrapped handler called %d times", tt.target, handlerCalled)
+		}
+		if g, e := rec.Code, tt.wantCode; g != e {
+			t.Errorf("test %q: status = %d, want %d", tt.target, g, e)
+		}
+		if g, e := rec.Body.String(), tt.wantBody; g != e {
+			t.Errorf("test %q: body = %q, want %q", tt.target, g, e)
+		}
+	}
+}
@@ -9,29 +9,188 @@
 package testhandlers // import "go.ltgt.net/net/http/testhandlers"
 
 import (
+	"context"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
 
-var sleep = time.Sleep
-
 // Delay wraps an http.Handler to delay it based on the request's query-string,
 // expecting a query parameter named 'delay' whose value is a duration (parsed
 // using time.ParseDuration).
 //
 // The wrapped handler will be called immediately in case the 'delay' query
 // parameter is absent or its value is malformed or negative.
+//
+// Other parts of the response can be delayed with the following query
+// parameters, whose values are also durations:
+//
+//   - 'delay_headers' delays sending the response headers (when the wrapped
+//     handler calls WriteHeader, or Write for the first time)
+//   - 'delay_body' delays sending the response body after its headers have
+//     been sent (and flushed)
+//   - 'delay_end' delays sending the last byte of the response body (all
+//     other bytes being flushed), once the wrapped handler has returned
+//
+// If the request is canceled during a delay (such as when the client gives
+// up), the wrapped handler isn't called (or nothing more is sent if it's
+// already been called). Use a DelayHandler to be notified.
 func Delay(h http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		q := r.URL.Query()
-		if d := q.Get("delay"); d != "" {
-			if dd, err := time.ParseDuration(d); err == nil {
-				sleep(dd)
-			}
+	return &DelayHandler{Handler: h}
+}
+
+// A DelayHandler is an http.Handler that delays the wrapped Handler based on
+// the request's query-string, as described in Delay.
+//
+// Delay returns a DelayHandler whose only field set is Handler.
+type DelayHandler struct {
+	// Handler is the wrapped handler.
+	Handler http.Handler
+
+	// Canceled, if not nil, is called with requests that have been canceled
+	// during the delay, instead of calling Handler. This allows tests to
+	// check that a client gave up waiting:
+	//
+	//	canceled := make(chan *http.Request, 1)
+	//	h := &testhandlers.DelayHandler{
+	//		Handler:  handler,
+	//		Canceled: func(r *http.Request) { canceled <- r },
+	//	}
+	Canceled func(r *http.Request)
+
+	// Clock is used to wait for the delay. If nil, the real time is used.
+	Clock Clock
+}
+
+func (d *DelayHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if !sleep(r.Context(), d.Clock, queryDuration(q, "delay")) {
+		d.canceled(r)
+		return
+	}
+	dw := &delayWriter{
+		w:       w,
+		r:       r,
+		d:       d,
+		headers: queryDuration(q, "delay_headers"),
+		body:    queryDuration(q, "delay_body"),
+		end:     queryDuration(q, "delay_end"),
+	}
+	if dw.headers <= 0 && dw.body <= 0 && dw.end <= 0 {
+		d.Handler.ServeHTTP(w, r)
+		return
+	}
+	d.Handler.ServeHTTP(dw, r)
+	dw.finish()
+}
+
+func (d *DelayHandler) canceled(r *http.Request) {
+	if d.Canceled != nil {
+		d.Canceled(r)
+	}
+}
+
+// queryDuration returns the duration in the named query parameter, or zero
+// if it's absent or malformed.
+func queryDuration(q url.Values, name string) time.Duration {
+	d, err := time.ParseDuration(q.Get(name))
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// A delayWriter is an http.ResponseWriter that delays sending the headers,
+// the body, and the last byte of the body.
+type delayWriter struct {
+	w                  http.ResponseWriter
+	r                  *http.Request
+	d                  *DelayHandler
+	headers, body, end time.Duration
+
+	wroteHeader bool
+	wroteBody   bool
+	pending     []byte // last byte written, held back until finish
+	err         error  // set once the request has been canceled
+}
+
+func (dw *delayWriter) Header() http.Header {
+	return dw.w.Header()
+}
+
+func (dw *delayWriter) WriteHeader(code int) {
+	if dw.wroteHeader || !dw.sleep(dw.headers) {
+		return
+	}
+	dw.wroteHeader = true
+	dw.w.WriteHeader(code)
+	if dw.body > 0 {
+		dw.Flush()
+	}
+}
+
+func (dw *delayWriter) Write(p []byte) (int, error) {
+	if !dw.wroteHeader {
+		dw.WriteHeader(http.StatusOK)
+	}
+	if len(p) == 0 || dw.err != nil {
+		return 0, dw.err
+	}
+	if !dw.wroteBody {
+		dw.wroteBody = true
+		if !dw.sleep(dw.body) {
+			return 0, dw.err
 		}
-		h.ServeHTTP(w, r)
-	})
+	}
+	if dw.end <= 0 {
+		return dw.w.Write(p)
+	}
+	if len(dw.pending) > 0 {
+		if _, err := dw.w.Write(dw.pending); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := dw.w.Write(p[:len(p)-1]); err != nil {
+		return 0, err
+	}
+	dw.pending = append(dw.pending[:0], p[len(p)-1])
+	dw.Flush()
+	return len(p), nil
+}
+
+func (dw *delayWriter) Flush() {
+	if f, ok := dw.w.(http.Flusher); ok && dw.err == nil {
+		f.Flush()
+	}
+}
+
+// finish sends the headers if the wrapped handler didn't, then the last byte
+// of the body after the end delay.
+func (dw *delayWriter) finish() {
+	if !dw.wroteHeader {
+		dw.WriteHeader(http.StatusOK)
+	}
+	if !dw.sleep(dw.end) {
+		return
+	}
+	if len(dw.pending) > 0 {
+		dw.w.Write(dw.pending)
+	}
+}
+
+// sleep waits for the duration d, and reports whether the request is still
+// alive afterwards.
+func (dw *delayWriter) sleep(d time.Duration) bool {
+	if dw.err != nil {
+		return false
+	}
+	if !sleep(dw.r.Context(), dw.d.Clock, d) {
+		dw.err = dw.r.Context().Err()
+		dw.d.canceled(dw.r)
+		return false
+	}
+	return true
 }
 
 // AddHeaders wraps an http.Handler to add response headers based on the
@@ -54,3 +213,20 @@ func AddHeaders(h http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// sleep pauses for the duration d according to the clock (or the real time if
+// nil), or until ctx is done, and reports whether the full duration elapsed.
+func sleep(ctx context.Context, c Clock, d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	// Stop the timer if ctx is done first, releasing it as soon as possible
+	t := clockOrDefault(c).NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
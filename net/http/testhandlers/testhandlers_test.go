@@ -5,6 +5,8 @@
 package testhandlers
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,12 +14,6 @@ import (
 )
 
 func TestDelay(t *testing.T) {
-	var delay time.Duration
-	var sleepCalled int
-	sleep = func(d time.Duration) {
-		sleepCalled++
-		delay = d
-	}
 	var handlerCalled int
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		handlerCalled++
@@ -48,6 +44,10 @@ func TestDelay(t *testing.T) {
 			target:           "/?delay=10msinvalid",
 			wantSleepSkipped: true,
 		},
+		{
+			target:           "/?delay=-10ms",
+			wantSleepSkipped: true,
+		},
 		{
 			target:    "/?delay=10ms",
 			wantDelay: 10 * time.Millisecond,
@@ -59,28 +59,171 @@ func TestDelay(t *testing.T) {
 	}
 
 	for _, tt := range testData {
-		delay, sleepCalled, handlerCalled = 0, 0, 0
+		handlerCalled = 0
+		clock := NewFakeClock(time.Now())
 
 		req := httptest.NewRequest("", tt.target, nil)
 		rec := httptest.NewRecorder()
-		Delay(handler).ServeHTTP(rec, req)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			(&DelayHandler{Handler: handler, Clock: clock}).ServeHTTP(rec, req)
+		}()
 
-		wantSleepCalled := 1
-		if tt.wantSleepSkipped {
-			wantSleepCalled = 0
-		}
-		if g, e := sleepCalled, wantSleepCalled; g != e {
-			t.Errorf("test %q: sleep function called %d times, want %d", tt.target, g, e)
-		} else if g, e := delay, tt.wantDelay; g != e {
-			t.Errorf("test %q: delay = %s, want %s", tt.target, g, e)
+		if !tt.wantSleepSkipped {
+			clock.BlockUntil(1)
+			clock.Advance(tt.wantDelay - 1)
+			select {
+			case <-done:
+				t.Errorf("test %q: delay shorter than %s", tt.target, tt.wantDelay)
+			default:
+			}
+			clock.Advance(1)
 		}
+		<-done
 
+		if g, e := clock.Waiters(), 0; g != e {
+			t.Errorf("test %q: %d pending waits, want %d", tt.target, g, e)
+		}
 		if g, e := handlerCalled, 1; g != e {
 			t.Errorf("test %q: wrapped handler called %d times, want %d", tt.target, g, e)
 		}
 	}
 }
 
+func TestDelayCanceled(t *testing.T) {
+	var handlerCalled int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlerCalled++
+	})
+	var canceled []*http.Request
+	h := &DelayHandler{
+		Handler:  handler,
+		Canceled: func(r *http.Request) { canceled = append(canceled, r) },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("", "/?delay=1h", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, req)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler still sleeping after the request was canceled")
+	}
+
+	if g, e := handlerCalled, 0; g != e {
+		t.Errorf("wrapped handler called %d times, want %d", g, e)
+	}
+	if g, e := len(canceled), 1; g != e {
+		t.Errorf("canceled called %d times, want %d", g, e)
+	} else if canceled[0] != req {
+		t.Errorf("canceled called with %v, want %v", canceled[0], req)
+	}
+
+	// Requests that aren't canceled aren't reported
+	canceled = nil
+	req = httptest.NewRequest("", "/?delay=1ms", nil)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+	if g, e := handlerCalled, 1; g != e {
+		t.Errorf("wrapped handler called %d times, want %d", g, e)
+	}
+	if g, e := len(canceled), 0; g != e {
+		t.Errorf("canceled called %d times, want %d", g, e)
+	}
+}
+
+func TestDelayParts(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Foo", "bar")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, "hello ")
+		io.WriteString(w, "world")
+	})
+	clock := NewFakeClock(time.Now())
+	h := &DelayHandler{Handler: handler, Clock: clock}
+
+	req := httptest.NewRequest("", "/?delay_headers=1s&delay_body=2s&delay_end=3s", nil)
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, req)
+	}()
+
+	for _, step := range []struct {
+		name        string
+		wantWritten bool
+		wantBody    string
+		advance     time.Duration
+	}{
+		{"delay_headers", false, "", time.Second},
+		{"delay_body", true, "", 2 * time.Second},
+		{"delay_end", true, "hello worl", 3 * time.Second},
+	} {
+		clock.BlockUntil(1)
+		if g, e := rec.Flushed, step.wantWritten; g != e {
+			t.Errorf("step %s: headers sent = %t, want %t", step.name, g, e)
+		}
+		if g, e := rec.Body.String(), step.wantBody; g != e {
+			t.Errorf("step %s: body = %q, want %q", step.name, g, e)
+		}
+		clock.Advance(step.advance)
+	}
+	<-done
+
+	if g, e := rec.Code, http.StatusCreated; g != e {
+		t.Errorf("status = %d, want %d", g, e)
+	}
+	if g, e := rec.Header().Get("X-Foo"), "bar"; g != e {
+		t.Errorf("x-foo = %q, want %q", g, e)
+	}
+	if g, e := rec.Body.String(), "hello world"; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
+
+func TestDelayPartsCanceled(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.WriteString(w, "hello"); err == nil {
+			t.Errorf("write succeeded after the request was canceled")
+		}
+	})
+	var canceled int
+	h := &DelayHandler{
+		Handler:  handler,
+		Canceled: func(r *http.Request) { canceled++ },
+		Clock:    NewFakeClock(time.Now()),
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest("", "/?delay_body=1s&delay_end=1s", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, req)
+	}()
+	h.Clock.(*FakeClock).BlockUntil(1)
+	cancel()
+	<-done
+
+	if g, e := canceled, 1; g != e {
+		t.Errorf("canceled called %d times, want %d", g, e)
+	}
+	if g, e := h.Clock.(*FakeClock).Waiters(), 0; g != e {
+		t.Errorf("waiters = %d, want %d", g, e)
+	}
+	if g, e := rec.Body.String(), ""; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}
+
 func TestAddHeaders(t *testing.T) {
 	var handlerCalled int
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -0,0 +1,165 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Throttle wraps an http.Handler to limit the bandwidth of its responses based
+// on the request's query-string, expecting a query parameter named 'rate'
+// whose value is a size followed by a slash and a duration, such as "10KB/s"
+// or "512B/100ms".
+//
+// The response body is sent in chunks, each being flushed, with pauses in
+// between so that the given rate is met. The size of those chunks can be set
+// with a 'chunk' query parameter (such as "chunk=1KiB"); it defaults to
+// a tenth of the bytes per second.
+//
+// Sizes are a decimal number followed by an optional unit: B, KB, MB and GB
+// (powers of 1000), or KiB, MiB and GiB (powers of 1024.) Durations are parsed
+// with time.ParseDuration, with a leading "1" being optional (so "s" is
+// equivalent to "1s".)
+//
+// The response is not throttled if the 'rate' query parameter is absent or
+// malformed.
+func Throttle(h http.Handler) http.Handler {
+	return &ThrottleHandler{Handler: h}
+}
+
+// A ThrottleHandler is an http.Handler that limits the bandwidth of the
+// wrapped Handler's responses based on the request's query-string, as
+// described in Throttle.
+//
+// Throttle returns a ThrottleHandler whose only field set is Handler.
+type ThrottleHandler struct {
+	// Handler is the wrapped handler.
+	Handler http.Handler
+
+	// Clock is used to pause between chunks. If nil, the real time is used.
+	Clock Clock
+}
+
+func (t *ThrottleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	bytesPerSec, err := parseRate(q.Get("rate"))
+	if err != nil {
+		t.Handler.ServeHTTP(w, r)
+		return
+	}
+	chunk, err := parseSize(q.Get("chunk"))
+	if err != nil || chunk <= 0 {
+		chunk = int64(math.Ceil(bytesPerSec / 10))
+	}
+	t.Handler.ServeHTTP(&throttleWriter{
+		ResponseWriter: w,
+		r:              r,
+		clock:          t.Clock,
+		bytesPerSec:    bytesPerSec,
+		chunk:          int(chunk),
+	}, r)
+}
+
+// A throttleWriter is an http.ResponseWriter that writes and flushes the
+// response body in chunks, pausing between them.
+type throttleWriter struct {
+	http.ResponseWriter
+	r           *http.Request
+	clock       Clock
+	bytesPerSec float64
+	chunk       int
+	pause       time.Duration // before the next chunk
+}
+
+func (tw *throttleWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		if !sleep(tw.r.Context(), tw.clock, tw.pause) {
+			return n, tw.r.Context().Err()
+		}
+		c := p
+		if len(c) > tw.chunk {
+			c = c[:tw.chunk]
+		}
+		m, err := tw.ResponseWriter.Write(c)
+		n += m
+		if err != nil {
+			return n, err
+		}
+		tw.Flush()
+		tw.pause = time.Duration(float64(m) / tw.bytesPerSec * float64(time.Second))
+		p = p[m:]
+	}
+	return n, nil
+}
+
+func (tw *throttleWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+var errMalformedRate = errors.New("testhandlers: malformed rate")
+
+// parseRate parses a rate such as "10KB/s" into a number of bytes per second.
+func parseRate(s string) (float64, error) {
+	i := strings.IndexByte(s, '/')
+	if i < 0 {
+		return 0, errMalformedRate
+	}
+	size, err := parseSize(s[:i])
+	if err != nil {
+		return 0, err
+	}
+	per := s[i+1:]
+	if per != "" && (per[0] < '0' || per[0] > '9') && per[0] != '.' {
+		per = "1" + per
+	}
+	d, err := time.ParseDuration(per)
+	if err != nil {
+		return 0, err
+	}
+	if size <= 0 || d <= 0 {
+		return 0, errMalformedRate
+	}
+	return float64(size) / d.Seconds(), nil
+}
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+}
+
+var errMalformedSize = errors.New("testhandlers: malformed size")
+
+// parseSize parses a size such as "10KB" into a number of bytes.
+func parseSize(s string) (int64, error) {
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := sizeUnits[s[i:]]
+	if !ok {
+		return 0, errMalformedSize
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, errMalformedSize
+	}
+	return int64(n * unit), nil
+}
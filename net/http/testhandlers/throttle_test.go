@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Thomas Broyer. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package testhandlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	testData := []struct {
+		rate        string
+		wantErr     bool
+		bytesPerSec float64
+	}{
+		{rate: "10B/s", bytesPerSec: 10},
+		{rate: "10/s", bytesPerSec: 10},
+		{rate: "10KB/s", bytesPerSec: 10000},
+		{rate: "1KiB/s", bytesPerSec: 1024},
+		{rate: "1.5MB/s", bytesPerSec: 1.5e6},
+		{rate: "512B/100ms", bytesPerSec: 5120},
+		{rate: "1GB/2s", bytesPerSec: 5e8},
+		{rate: "", wantErr: true},
+		{rate: "10KB", wantErr: true},
+		{rate: "10XB/s", wantErr: true},
+		{rate: "KB/s", wantErr: true},
+		{rate: "10KB/x", wantErr: true},
+		{rate: "0B/s", wantErr: true},
+		{rate: "10KB/0s", wantErr: true},
+	}
+	for _, tt := range testData {
+		g, err := parseRate(tt.rate)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("test %q: expected error, got %v", tt.rate, g)
+			}
+		} else if err != nil {
+			t.Errorf("test %q: %v", tt.rate, err)
+		} else if e := tt.bytesPerSec; g != e {
+			t.Errorf("test %q: rate = %v, want %v", tt.rate, g, e)
+		}
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "0123456")
+		io.WriteString(w, "789abcde")
+	})
+	clock := NewFakeClock(time.Now())
+	h := &ThrottleHandler{Handler: handler, Clock: clock}
+
+	req := httptest.NewRequest("", "/?rate=10B/s&chunk=5", nil)
+	rec := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		h.ServeHTTP(rec, req)
+	}()
+
+	for _, step := range []struct {
+		wantBody string
+		advance  time.Duration
+	}{
+		{"01234", 500 * time.Millisecond},
+		{"0123456", 200 * time.Millisecond},
+		{"0123456789ab", 500 * time.Millisecond},
+	} {
+		clock.BlockUntil(1)
+		if g, e := rec.Body.String(), step.wantBody; g != e {
+			t.Errorf("body = %q, want %q", g, e)
+		}
+		if !rec.Flushed {
+			t.Errorf("body %q not flushed", step.wantBody)
+		}
+		clock.Advance(step.advance - 1)
+		if g, e := clock.Waiters(), 1; g != e {
+			t.Errorf("body %q: paused for less than %s", step.wantBody, step.advance)
+		}
+		clock.Advance(1)
+	}
+	<-done
+	if g, e := rec.Body.String(), "0123456789abcde"; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+
+	// Not throttled
+	req = httptest.NewRequest("", "/?rate=invalid", nil)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if g, e := rec.Body.String(), "0123456789abcde"; g != e {
+		t.Errorf("body = %q, want %q", g, e)
+	}
+}